@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"codex-mcp/internal/server"
 )
 
+// version is overridden at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 	defaultStatePath, defaultDBPath, defaultProfilePath := defaultPathsFromExecutable()
@@ -20,14 +27,45 @@ func main() {
 		StatePath:        envOrDefault("CODEX_TROLLER_STATE_PATH", defaultStatePath),
 		DiscussionDBPath: envOrDefault("CODEX_TROLLER_DISCUSSION_DB_PATH", defaultDBPath),
 		DefaultProfile:   envOrDefault("CODEX_TROLLER_DEFAULT_PROFILE_PATH", defaultProfilePath),
+		Version:          version,
+		StrictSessionIDs: envBool("CODEX_TROLLER_STRICT_SESSIONS"),
+		Retention: server.RetentionPolicy{
+			SummarizedMaxAge: time.Duration(envInt("CODEX_TROLLER_RETENTION_DAYS")) * 24 * time.Hour,
+			MaxSessions:      envInt("CODEX_TROLLER_MAX_SESSIONS"),
+		},
+		// One regular expression per line, added to the built-in secret
+		// detectors applied to command output.
+		RedactPatterns: strings.Split(os.Getenv("CODEX_TROLLER_REDACT_PATTERNS"), "\n"),
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1:]))
 	}
 
 	srv := server.NewMCPServer(cfg)
+	if err := srv.StateError(); errors.Is(err, server.ErrSchemaTooNew) {
+		logger.Error("refusing to start: state was written by a newer codex-mcp", "db", cfg.DiscussionDBPath, "error", err)
+		os.Exit(1)
+	}
+	// Retention runs once per start so a long-lived state directory stays
+	// bounded; `codex-mcp sessions prune -dry-run` previews it.
+	if pruned, err := srv.PruneSessions(false); err != nil {
+		logger.Warn("pruning sessions failed", "error", err)
+	} else if len(pruned) > 0 {
+		logger.Info("archived sessions under the retention policy", "count", len(pruned))
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	if err := srv.Run(ctx); err != nil {
+	// CODEX_TROLLER_HTTP_ADDR opts into the streamable HTTP transport
+	// (loopback host:port or unix:/path) so several clients can share one
+	// server and state; stdio stays the default.
+	run := srv.Run
+	if addr := os.Getenv("CODEX_TROLLER_HTTP_ADDR"); addr != "" {
+		run = func(ctx context.Context) error { return srv.RunHTTP(ctx, addr) }
+	}
+	if err := run(ctx); err != nil {
 		logger.Error("server terminated", "error", err)
 		os.Exit(1)
 	}
@@ -41,6 +79,18 @@ func envOrDefault(key, fallback string) string {
 	return value
 }
 
+// envBool reports whether key is set to a true value such as 1 or true.
+func envBool(key string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(key))
+	return value
+}
+
+// envInt returns key as an integer, or zero when it is unset or invalid.
+func envInt(key string) int {
+	value, _ := strconv.Atoi(os.Getenv(key))
+	return value
+}
+
 func defaultPathsFromExecutable() (statePath, discussionDBPath, defaultProfilePath string) {
 	exePath, err := os.Executable()
 	if err != nil {
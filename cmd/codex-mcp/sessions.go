@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"codex-mcp/internal/server"
+)
+
+// tagList collects a repeatable -tag flag.
+type tagList []string
+
+func (t *tagList) String() string { return strings.Join(*t, ",") }
+
+func (t *tagList) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+func runSessionsList(cfg server.Config, args []string) int {
+	fs := flag.NewFlagSet("sessions list", flag.ContinueOnError)
+	var filter server.SessionFilter
+	var tags tagList
+	var after, before string
+	fs.StringVar(&filter.Step, "step", "", "only sessions at this step")
+	fs.StringVar(&filter.Goal, "goal", "", "text the intent goal contains")
+	fs.StringVar(&filter.Query, "query", "", "text in the session ID, goal, raw intent or tags")
+	fs.StringVar(&filter.Branch, "branch", "", "git branch the session started on")
+	fs.Var(&tags, "tag", "requirement tag the session must have (repeatable)")
+	fs.StringVar(&after, "updated-after", "", "RFC 3339 time or YYYY-MM-DD date")
+	fs.StringVar(&before, "updated-before", "", "RFC 3339 time or YYYY-MM-DD date")
+	fs.IntVar(&filter.Limit, "limit", 20, "page size, at most 100")
+	fs.IntVar(&filter.Offset, "offset", 0, "skip this many matching sessions")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	filter.Tags = tags
+	var err error
+	if filter.UpdatedAfter, err = server.ParseSessionTime("-updated-after", after); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if filter.UpdatedBefore, err = server.ParseSessionTime("-updated-before", before); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	srv := server.NewMCPServer(cfg)
+	if err := srv.StateError(); err != nil {
+		fmt.Fprintln(os.Stderr, "load sessions:", err)
+		return 1
+	}
+	page := srv.ListSessions(filter)
+	if page.Total == 0 {
+		fmt.Println("no sessions found")
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tSTEP\tUPDATED\tBRANCH\tTAGS\tGOAL")
+	for _, s := range page.Sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.SessionID, s.Step, s.UpdatedAt.Format("2006-01-02 15:04:05Z"), s.Branch, strings.Join(s.RequirementTags, ","), s.Goal)
+	}
+	_ = w.Flush()
+	if page.NextOffset > 0 {
+		fmt.Printf("showing %d of %d; next page: -offset %d\n", len(page.Sessions), page.Total, page.NextOffset)
+	}
+	return 0
+}
+
+// runSessionsPrune archives the sessions the retention policy selects. The
+// -days and -max flags override the policy from the environment.
+func runSessionsPrune(cfg server.Config, args []string) int {
+	fs := flag.NewFlagSet("sessions prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list the sessions that would be archived without archiving them")
+	days := fs.Int("days", int(cfg.Retention.SummarizedMaxAge/(24*time.Hour)), "archive summarized sessions idle for more than this many days; 0 keeps them")
+	maxSessions := fs.Int("max", cfg.Retention.MaxSessions, "archive the least recently updated sessions beyond this count; 0 keeps them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg.Retention = server.RetentionPolicy{
+		SummarizedMaxAge: time.Duration(*days) * 24 * time.Hour,
+		MaxSessions:      *maxSessions,
+	}
+	if cfg.Retention.SummarizedMaxAge <= 0 && cfg.Retention.MaxSessions <= 0 {
+		fmt.Fprintln(os.Stderr, "no retention policy: set -days or -max (or CODEX_TROLLER_RETENTION_DAYS / CODEX_TROLLER_MAX_SESSIONS)")
+		return 2
+	}
+
+	srv := server.NewMCPServer(cfg)
+	if err := srv.StateError(); err != nil {
+		fmt.Fprintln(os.Stderr, "load sessions:", err)
+		return 1
+	}
+	pruned, err := srv.PruneSessions(*dryRun)
+	if len(pruned) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSION\tSTEP\tUPDATED\tREASON\tARCHIVE")
+		for _, p := range pruned {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.SessionID, p.Step, p.UpdatedAt.Format("2006-01-02 15:04:05Z"), p.Reason, p.Archive)
+		}
+		_ = w.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "prune:", err)
+		return 1
+	}
+	switch {
+	case len(pruned) == 0:
+		fmt.Println("no sessions to prune")
+	case *dryRun:
+		fmt.Printf("dry run: %d sessions would be archived\n", len(pruned))
+	default:
+		fmt.Printf("archived %d sessions\n", len(pruned))
+	}
+	return 0
+}
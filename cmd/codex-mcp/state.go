@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"codex-mcp/internal/server"
+)
+
+const usage = `usage:
+  codex-mcp                         serve MCP over stdio (or HTTP with CODEX_TROLLER_HTTP_ADDR)
+  codex-mcp state recover           list state backups and quarantined files
+  codex-mcp state recover <backup>  restore a backup into the state database
+  codex-mcp sessions list [flags]   list sessions; -h shows the filters
+  codex-mcp sessions prune [flags]  archive sessions the retention policy drops; -dry-run previews`
+
+// runCommand handles CLI subcommands and returns the process exit code.
+func runCommand(cfg server.Config, args []string) int {
+	if len(args) >= 2 && args[0] == "state" && args[1] == "recover" {
+		return runStateRecover(cfg, args[2:])
+	}
+	if len(args) >= 2 && args[0] == "sessions" && args[1] == "list" {
+		return runSessionsList(cfg, args[2:])
+	}
+	if len(args) >= 2 && args[0] == "sessions" && args[1] == "prune" {
+		return runSessionsPrune(cfg, args[2:])
+	}
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
+
+func runStateRecover(cfg server.Config, args []string) int {
+	switch len(args) {
+	case 0:
+		backups, err := server.ListStateBackups(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "list backups:", err)
+			return 1
+		}
+		if len(backups) == 0 {
+			fmt.Println("no backups found")
+			return 0
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tKIND\tCREATED\tSIZE")
+		for _, b := range backups {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", b.Name, b.Kind, b.CreatedAt.Format("2006-01-02 15:04:05Z"), b.SizeBytes)
+		}
+		_ = w.Flush()
+		return 0
+	case 1:
+		safety, err := server.RestoreStateBackup(cfg, args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "restore:", err)
+			return 1
+		}
+		fmt.Printf("restored %s; previous state saved as %s\n", args[0], safety)
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
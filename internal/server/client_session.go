@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// supportedProtocolVersions lists the MCP revisions this server speaks,
+// newest first. The first entry is offered when the client asks for an
+// unknown revision.
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+type initializeParams struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    clientCapabilities `json:"capabilities"`
+	ClientInfo      struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"clientInfo"`
+}
+
+// clientCapabilities records the optional client features the server may
+// rely on. A nil field means the client did not declare it.
+type clientCapabilities struct {
+	Elicitation map[string]any `json:"elicitation,omitempty"`
+	Sampling    map[string]any `json:"sampling,omitempty"`
+	Roots       map[string]any `json:"roots,omitempty"`
+}
+
+// clientState is what the server knows about one connected client, keyed by
+// request scope ("" for stdio, the transport session for HTTP).
+type clientState struct {
+	ProtocolVersion string
+	Capabilities    clientCapabilities
+	Name            string
+	Version         string
+	Initialized     bool
+}
+
+func negotiateProtocolVersion(requested string) string {
+	for _, version := range supportedProtocolVersions {
+		if version == requested {
+			return version
+		}
+	}
+	return supportedProtocolVersions[0]
+}
+
+func (s *MCPServer) initialize(ctx context.Context, raw json.RawMessage) map[string]any {
+	var params initializeParams
+	if len(raw) > 0 {
+		// Malformed params are tolerated; the client then gets the latest
+		// revision and no optional features.
+		_ = json.Unmarshal(raw, &params)
+	}
+	version := negotiateProtocolVersion(params.ProtocolVersion)
+	s.mu.Lock()
+	s.clients[requestScopeFromContext(ctx)] = &clientState{
+		ProtocolVersion: version,
+		Capabilities:    params.Capabilities,
+		Name:            params.ClientInfo.Name,
+		Version:         params.ClientInfo.Version,
+	}
+	s.mu.Unlock()
+	s.logger.Info("client initialized", "client", params.ClientInfo.Name, "requested_version", params.ProtocolVersion, "protocol_version", version)
+
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities": map[string]any{
+			"tools": map[string]any{},
+			"resources": map[string]any{
+				"subscribe":   true,
+				"listChanged": false,
+			},
+			"prompts": map[string]any{
+				"listChanged": false,
+			},
+		},
+		"serverInfo": map[string]any{
+			"name":    "codex-mcp-local",
+			"version": s.cfg.Version,
+		},
+	}
+}
+
+func (s *MCPServer) markClientInitialized(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[requestScopeFromContext(ctx)]; ok {
+		client.Initialized = true
+	}
+}
+
+// clientFor returns a copy of the calling client's state, if it initialized.
+func (s *MCPServer) clientFor(ctx context.Context) (clientState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[requestScopeFromContext(ctx)]
+	if !ok {
+		return clientState{}, false
+	}
+	return *client, true
+}
+
+// forgetClient drops state kept for a departed client.
+func (s *MCPServer) forgetClient(scope string) {
+	s.mu.Lock()
+	delete(s.clients, scope)
+	s.mu.Unlock()
+	s.dropSubscriptions(scope)
+}
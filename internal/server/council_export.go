@@ -0,0 +1,384 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// councilExport is every council row of a session in a form that does not
+// depend on row IDs, so it can be loaded under another session ID or into
+// another database. Topic references use the exported topic's position.
+type councilExport struct {
+	Session       *exportedCouncilSession  `json:"session"`
+	Roles         []exportedCouncilRole    `json:"roles"`
+	Topics        []exportedCouncilTopic   `json:"topics"`
+	FloorRequests []exportedFloorRequest   `json:"floor_requests"`
+	Votes         []exportedTopicVote      `json:"votes"`
+	Messages      []exportedCouncilMessage `json:"messages"`
+	Proposals     []exportedProposal       `json:"proposals"`
+}
+
+type exportedCouncilSession struct {
+	Status    string    `json:"status"`
+	Phase     string    `json:"phase"`
+	Summary   string    `json:"summary"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportedCouncilRole struct {
+	councilRoleState
+	Brief string `json:"brief"`
+}
+
+type exportedCouncilTopic struct {
+	councilTopic
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportedFloorRequest struct {
+	TopicID   int64     `json:"topic_id"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportedTopicVote struct {
+	TopicID   int64     `json:"topic_id"`
+	Role      string    `json:"role"`
+	Decision  string    `json:"decision"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportedCouncilMessage struct {
+	councilMessage
+}
+
+type exportedProposal struct {
+	ConsultProposal
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// exportCouncil reads every council row of a session. IDs are kept as read;
+// importCouncil assigns new ones.
+func (c *councilStore) exportCouncil(sessionID string) (councilExport, error) {
+	out := councilExport{
+		Roles:         []exportedCouncilRole{},
+		Topics:        []exportedCouncilTopic{},
+		FloorRequests: []exportedFloorRequest{},
+		Votes:         []exportedTopicVote{},
+		Messages:      []exportedCouncilMessage{},
+		Proposals:     []exportedProposal{},
+	}
+	var meta exportedCouncilSession
+	var created, updated string
+	err := c.db.QueryRow(
+		`SELECT status, phase, summary, created_at, updated_at FROM council_sessions WHERE session_id=?`,
+		sessionID,
+	).Scan(&meta.Status, &meta.Phase, &meta.Summary, &created, &updated)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return councilExport{}, err
+	default:
+		meta.CreatedAt, meta.UpdatedAt = parseTimeOrZero(created), parseTimeOrZero(updated)
+		out.Session = &meta
+	}
+
+	err = queryEach(c.db, `SELECT role, domain, model, brief, brief_submitted, priority, contribution, quick_decisions
+		 FROM council_roles WHERE session_id=? ORDER BY role`, sessionID, func(rows *sql.Rows) error {
+		var item exportedCouncilRole
+		var submitted int
+		if err := rows.Scan(&item.Role, &item.Domain, &item.Model, &item.Brief, &submitted, &item.Priority, &item.Contribution, &item.QuickDecisions); err != nil {
+			return err
+		}
+		item.BriefSubmitted = submitted == 1
+		out.Roles = append(out.Roles, item)
+		return nil
+	})
+	if err != nil {
+		return councilExport{}, err
+	}
+	err = queryEach(c.db, `SELECT id, topic_key, title, detail, status, created_by, created_at, updated_at
+		 FROM council_topics WHERE session_id=? ORDER BY id`, sessionID, func(rows *sql.Rows) error {
+		var item exportedCouncilTopic
+		var created, updated string
+		if err := rows.Scan(&item.ID, &item.TopicKey, &item.Title, &item.Detail, &item.Status, &item.CreatedBy, &created, &updated); err != nil {
+			return err
+		}
+		item.CreatedAt, item.UpdatedAt = parseTimeOrZero(created), parseTimeOrZero(updated)
+		out.Topics = append(out.Topics, item)
+		return nil
+	})
+	if err != nil {
+		return councilExport{}, err
+	}
+	err = queryEach(c.db, `SELECT topic_id, role, status, reason, created_at, updated_at
+		 FROM council_floor_requests WHERE session_id=? ORDER BY id`, sessionID, func(rows *sql.Rows) error {
+		var item exportedFloorRequest
+		var created, updated string
+		if err := rows.Scan(&item.TopicID, &item.Role, &item.Status, &item.Reason, &created, &updated); err != nil {
+			return err
+		}
+		item.CreatedAt, item.UpdatedAt = parseTimeOrZero(created), parseTimeOrZero(updated)
+		out.FloorRequests = append(out.FloorRequests, item)
+		return nil
+	})
+	if err != nil {
+		return councilExport{}, err
+	}
+	err = queryEach(c.db, `SELECT topic_id, role, decision, updated_at
+		 FROM council_topic_votes WHERE session_id=? ORDER BY topic_id, role`, sessionID, func(rows *sql.Rows) error {
+		var item exportedTopicVote
+		var updated string
+		if err := rows.Scan(&item.TopicID, &item.Role, &item.Decision, &updated); err != nil {
+			return err
+		}
+		item.UpdatedAt = parseTimeOrZero(updated)
+		out.Votes = append(out.Votes, item)
+		return nil
+	})
+	if err != nil {
+		return councilExport{}, err
+	}
+	err = queryEach(c.db, `SELECT id, topic_id, role, action, content, created_at
+		 FROM council_messages WHERE session_id=? ORDER BY id`, sessionID, func(rows *sql.Rows) error {
+		var item exportedCouncilMessage
+		var created string
+		if err := rows.Scan(&item.ID, &item.TopicID, &item.Role, &item.Action, &item.Content, &created); err != nil {
+			return err
+		}
+		item.CreatedAt = parseTimeOrZero(created)
+		out.Messages = append(out.Messages, item)
+		return nil
+	})
+	if err != nil {
+		return councilExport{}, err
+	}
+	err = queryEach(c.db, `SELECT version, domain, summary, options_json, recommended, user_decision, user_feedback, created_at, updated_at
+		 FROM council_proposals WHERE session_id=? ORDER BY version`, sessionID, func(rows *sql.Rows) error {
+		var item exportedProposal
+		var optionsJSON, created, updated string
+		if err := rows.Scan(&item.Version, &item.Domain, &item.Summary, &optionsJSON, &item.Recommended, &item.UserDecision, &item.UserFeedback, &created, &updated); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(optionsJSON), &item.Options); err != nil {
+			return fmt.Errorf("proposal %d options: %w", item.Version, err)
+		}
+		item.CreatedAt, item.UpdatedAt = parseTimeOrZero(created), parseTimeOrZero(updated)
+		out.Proposals = append(out.Proposals, item)
+		return nil
+	})
+	if err != nil {
+		return councilExport{}, err
+	}
+	return out, nil
+}
+
+func queryEach(db *sql.DB, query string, sessionID string, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// validate checks that every topic reference points at an exported topic.
+func (e councilExport) validate() error {
+	topics := map[int64]bool{}
+	for _, topic := range e.Topics {
+		if topics[topic.ID] {
+			return fmt.Errorf("duplicate council topic %d", topic.ID)
+		}
+		topics[topic.ID] = true
+	}
+	for _, req := range e.FloorRequests {
+		if !topics[req.TopicID] {
+			return fmt.Errorf("floor request by %s references unknown topic %d", req.Role, req.TopicID)
+		}
+	}
+	for _, vote := range e.Votes {
+		if !topics[vote.TopicID] {
+			return fmt.Errorf("vote by %s references unknown topic %d", vote.Role, vote.TopicID)
+		}
+	}
+	for _, msg := range e.Messages {
+		// Topic 0 marks session-wide messages.
+		if msg.TopicID != 0 && !topics[msg.TopicID] {
+			return fmt.Errorf("message %d references unknown topic %d", msg.ID, msg.TopicID)
+		}
+	}
+	return nil
+}
+
+// importCouncil writes exported council rows under sessionID, replacing
+// any it has, in one transaction. Topics get new IDs and the rows
+// referring to them follow.
+func (c *councilStore) importCouncil(sessionID string, data councilExport) (err error) {
+	if err := data.validate(); err != nil {
+		return err
+	}
+	tx, err := beginTx(c.db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	for _, table := range councilSessionTables {
+		if _, err = tx.Exec(`DELETE FROM `+table+` WHERE session_id=?`, sessionID); err != nil {
+			return err
+		}
+	}
+	if data.Session != nil {
+		if err = insertCouncilSession(tx, sessionID, *data.Session); err != nil {
+			return err
+		}
+	}
+	if err = insertCouncilRoles(tx, sessionID, data.Roles); err != nil {
+		return err
+	}
+	topicIDs, err := insertCouncilTopics(tx, sessionID, data.Topics)
+	if err != nil {
+		return err
+	}
+	if err = insertFloorRequests(tx, sessionID, data.FloorRequests, topicIDs); err != nil {
+		return err
+	}
+	if err = insertTopicVotes(tx, sessionID, data.Votes, topicIDs); err != nil {
+		return err
+	}
+	if err = insertCouncilMessages(tx, sessionID, data.Messages, topicIDs); err != nil {
+		return err
+	}
+	if err = insertConsultProposals(tx, sessionID, data.Proposals); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storedTime formats a timestamp for the council tables; a missing one is
+// stored as now.
+func storedTime(t time.Time) string {
+	if t.IsZero() {
+		return nowRFC3339()
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func insertCouncilSession(tx *sql.Tx, sessionID string, meta exportedCouncilSession) error {
+	_, err := tx.Exec(
+		`INSERT INTO council_sessions(session_id,status,phase,summary,created_at,updated_at) VALUES(?,?,?,?,?,?)`,
+		sessionID, meta.Status, meta.Phase, meta.Summary, storedTime(meta.CreatedAt), storedTime(meta.UpdatedAt),
+	)
+	return err
+}
+
+func insertCouncilRoles(tx *sql.Tx, sessionID string, roles []exportedCouncilRole) error {
+	for _, role := range roles {
+		submitted := 0
+		if role.BriefSubmitted {
+			submitted = 1
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO council_roles(session_id,role,domain,model,brief,priority,contribution,quick_decisions,brief_submitted)
+			 VALUES(?,?,?,?,?,?,?,?,?)`,
+			sessionID, role.Role, role.Domain, role.Model, role.Brief, role.Priority, role.Contribution, role.QuickDecisions, submitted,
+		); err != nil {
+			return fmt.Errorf("role %s: %w", role.Role, err)
+		}
+	}
+	return nil
+}
+
+// insertCouncilTopics returns the new ID of each exported topic ID.
+func insertCouncilTopics(tx *sql.Tx, sessionID string, topics []exportedCouncilTopic) (map[int64]int64, error) {
+	ids := make(map[int64]int64, len(topics))
+	for _, topic := range topics {
+		res, err := tx.Exec(
+			`INSERT INTO council_topics(session_id,topic_key,title,detail,status,created_by,created_at,updated_at) VALUES(?,?,?,?,?,?,?,?)`,
+			sessionID, topic.TopicKey, topic.Title, topic.Detail, topic.Status, topic.CreatedBy, storedTime(topic.CreatedAt), storedTime(topic.UpdatedAt),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic.TopicKey, err)
+		}
+		if ids[topic.ID], err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func insertFloorRequests(tx *sql.Tx, sessionID string, requests []exportedFloorRequest, topicIDs map[int64]int64) error {
+	for _, req := range requests {
+		if _, err := tx.Exec(
+			`INSERT INTO council_floor_requests(session_id,topic_id,role,status,reason,created_at,updated_at) VALUES(?,?,?,?,?,?,?)`,
+			sessionID, topicIDs[req.TopicID], req.Role, req.Status, req.Reason, storedTime(req.CreatedAt), storedTime(req.UpdatedAt),
+		); err != nil {
+			return fmt.Errorf("floor request by %s: %w", req.Role, err)
+		}
+	}
+	return nil
+}
+
+func insertTopicVotes(tx *sql.Tx, sessionID string, votes []exportedTopicVote, topicIDs map[int64]int64) error {
+	for _, vote := range votes {
+		if _, err := tx.Exec(
+			`INSERT INTO council_topic_votes(session_id,topic_id,role,decision,updated_at) VALUES(?,?,?,?,?)`,
+			sessionID, topicIDs[vote.TopicID], vote.Role, vote.Decision, storedTime(vote.UpdatedAt),
+		); err != nil {
+			return fmt.Errorf("vote by %s: %w", vote.Role, err)
+		}
+	}
+	return nil
+}
+
+func insertCouncilMessages(tx *sql.Tx, sessionID string, messages []exportedCouncilMessage, topicIDs map[int64]int64) error {
+	for _, msg := range messages {
+		topicID := msg.TopicID
+		if topicID != 0 {
+			topicID = topicIDs[topicID]
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
+			sessionID, topicID, msg.Role, msg.Action, msg.Content, storedTime(msg.CreatedAt),
+		); err != nil {
+			return fmt.Errorf("message %d: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+func insertConsultProposals(tx *sql.Tx, sessionID string, proposals []exportedProposal) error {
+	for _, proposal := range proposals {
+		options, err := json.Marshal(proposal.Options)
+		if err != nil {
+			return err
+		}
+		if proposal.Options == nil {
+			options = []byte("[]")
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO council_proposals(session_id,version,domain,summary,options_json,recommended,user_decision,user_feedback,created_at,updated_at)
+			 VALUES(?,?,?,?,?,?,?,?,?,?)`,
+			sessionID, proposal.Version, proposal.Domain, proposal.Summary, string(options), proposal.Recommended, proposal.UserDecision, proposal.UserFeedback,
+			storedTime(proposal.CreatedAt), storedTime(proposal.UpdatedAt),
+		); err != nil {
+			return fmt.Errorf("proposal %d: %w", proposal.Version, err)
+		}
+	}
+	return nil
+}
@@ -48,138 +48,22 @@ func newCouncilStore(path string) (*councilStore, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite", path)
+	// Tool calls and other processes sharing the state directory write
+	// concurrently, so writers wait for each other and retry instead of
+	// failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, err
 	}
-	store := &councilStore{db: db}
-	if err := store.initSchema(); err != nil {
+	if _, err := execRetry(db, `PRAGMA journal_mode=WAL;`); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	return store, nil
-}
-
-func (c *councilStore) initSchema() error {
-	stmts := []string{
-		`PRAGMA journal_mode=WAL;`,
-		`CREATE TABLE IF NOT EXISTS council_sessions (
-			session_id TEXT PRIMARY KEY,
-			status TEXT NOT NULL,
-			phase TEXT NOT NULL,
-			summary TEXT NOT NULL DEFAULT '',
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		);`,
-		`CREATE TABLE IF NOT EXISTS council_roles (
-			session_id TEXT NOT NULL,
-			role TEXT NOT NULL,
-			domain TEXT NOT NULL DEFAULT 'general',
-			model TEXT NOT NULL,
-			brief TEXT NOT NULL DEFAULT '',
-			priority TEXT NOT NULL DEFAULT '',
-			contribution TEXT NOT NULL DEFAULT '',
-			quick_decisions TEXT NOT NULL DEFAULT '',
-			brief_submitted INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY(session_id, role)
-		);`,
-		`CREATE TABLE IF NOT EXISTS council_topics (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			session_id TEXT NOT NULL,
-			topic_key TEXT NOT NULL,
-			title TEXT NOT NULL,
-			detail TEXT NOT NULL DEFAULT '',
-			status TEXT NOT NULL DEFAULT 'open',
-			created_by TEXT NOT NULL DEFAULT '',
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		);`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_council_topic_unique ON council_topics(session_id, topic_key);`,
-		`CREATE TABLE IF NOT EXISTS council_floor_requests (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			session_id TEXT NOT NULL,
-			topic_id INTEGER NOT NULL,
-			role TEXT NOT NULL,
-			status TEXT NOT NULL,
-			reason TEXT NOT NULL DEFAULT '',
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		);`,
-		`CREATE TABLE IF NOT EXISTS council_topic_votes (
-			session_id TEXT NOT NULL,
-			topic_id INTEGER NOT NULL,
-			role TEXT NOT NULL,
-			decision TEXT NOT NULL,
-			updated_at TEXT NOT NULL,
-			PRIMARY KEY(session_id, topic_id, role)
-		);`,
-		`CREATE TABLE IF NOT EXISTS council_messages (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			session_id TEXT NOT NULL,
-			topic_id INTEGER NOT NULL DEFAULT 0,
-			role TEXT NOT NULL,
-			action TEXT NOT NULL,
-			content TEXT NOT NULL,
-			created_at TEXT NOT NULL
-		);`,
-		`CREATE TABLE IF NOT EXISTS council_proposals (
-			session_id TEXT NOT NULL,
-			version INTEGER NOT NULL,
-			domain TEXT NOT NULL,
-			summary TEXT NOT NULL,
-			options_json TEXT NOT NULL DEFAULT '[]',
-			recommended TEXT NOT NULL DEFAULT '',
-			user_decision TEXT NOT NULL DEFAULT '',
-			user_feedback TEXT NOT NULL DEFAULT '',
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL,
-			PRIMARY KEY(session_id, version)
-		);`,
-	}
-	for _, stmt := range stmts {
-		if _, err := c.db.Exec(stmt); err != nil {
-			return err
-		}
-	}
-	if err := c.ensureRoleDomainColumn(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (c *councilStore) ensureRoleDomainColumn() error {
-	rows, err := c.db.Query(`PRAGMA table_info(council_roles)`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	hasDomain := false
-	for rows.Next() {
-		var (
-			cid       int
-			name      string
-			colType   string
-			notNull   int
-			defaultV  sql.NullString
-			primaryPK int
-		)
-		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultV, &primaryPK); err != nil {
-			return err
-		}
-		if name == "domain" {
-			hasDomain = true
-			break
-		}
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-	if hasDomain {
-		return nil
+	if err := migrateDatabase(db); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
-	_, err = c.db.Exec(`ALTER TABLE council_roles ADD COLUMN domain TEXT NOT NULL DEFAULT 'general'`)
-	return err
+	return &councilStore{db: db}, nil
 }
 
 func nowRFC3339() string {
@@ -248,7 +132,7 @@ func (c *councilStore) startBriefing(sessionID string, routing AgentRoutingPolic
 	if len(managers) == 0 {
 		return nil, nil, fmt.Errorf("at least one manager role is required")
 	}
-	tx, err := c.db.Begin()
+	tx, err := beginTx(c.db)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -340,7 +224,7 @@ func (c *councilStore) startBriefing(sessionID string, routing AgentRoutingPolic
 
 func (c *councilStore) ensureSessionRow(sessionID string) error {
 	now := nowRFC3339()
-	_, err := c.db.Exec(
+	_, err := execRetry(c.db,
 		`INSERT INTO council_sessions(session_id,status,phase,summary,created_at,updated_at)
 		 VALUES(?,?,?,?,?,?)
 		 ON CONFLICT(session_id) DO UPDATE SET updated_at=excluded.updated_at`,
@@ -354,7 +238,7 @@ func (c *councilStore) resetConsultProposals(sessionID string) error {
 		return err
 	}
 	now := nowRFC3339()
-	tx, err := c.db.Begin()
+	tx, err := beginTx(c.db)
 	if err != nil {
 		return err
 	}
@@ -386,7 +270,7 @@ func (c *councilStore) upsertConsultProposal(sessionID string, proposal ConsultP
 	if proposal.CreatedAt.IsZero() {
 		created = now
 	}
-	tx, err := c.db.Begin()
+	tx, err := beginTx(c.db)
 	if err != nil {
 		return err
 	}
@@ -437,7 +321,7 @@ func (c *councilStore) submitBrief(sessionID, role, priority, contribution, quic
 		return fmt.Errorf("unknown role: %s", role)
 	}
 	now := nowRFC3339()
-	tx, err := c.db.Begin()
+	tx, err := beginTx(c.db)
 	if err != nil {
 		return err
 	}
@@ -529,13 +413,13 @@ func (c *councilStore) summarizeBriefs(sessionID string) (string, []councilTopic
 	summary := strings.Join(parts, "\n")
 
 	now := nowRFC3339()
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`UPDATE council_sessions SET phase='agenda_ready', summary=?, updated_at=? WHERE session_id=?`,
 		summary, now, sessionID,
 	); err != nil {
 		return "", nil, err
 	}
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
 		sessionID, 0, "moderator", "brief_summary", summary, now,
 	); err != nil {
@@ -569,7 +453,7 @@ func (c *councilStore) requestFloor(sessionID, role string, topicID int64, reaso
 	}
 
 	now := nowRFC3339()
-	res, err := c.db.Exec(
+	res, err := execRetry(c.db,
 		`INSERT INTO council_floor_requests(session_id,topic_id,role,status,reason,created_at,updated_at)
 		 VALUES(?,?,?,?,?,?,?)`,
 		sessionID, topicID, role, "requested", reason, now, now,
@@ -578,7 +462,7 @@ func (c *councilStore) requestFloor(sessionID, role string, topicID int64, reaso
 		return 0, err
 	}
 	requestID, _ := res.LastInsertId()
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
 		sessionID, topicID, role, "floor_requested", reason, now,
 	); err != nil {
@@ -601,13 +485,13 @@ func (c *councilStore) grantFloor(sessionID string, requestID int64) (int64, str
 	if requestStatus != "requested" {
 		return 0, "", fmt.Errorf("floor request %d is not in requested state", requestID)
 	}
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`UPDATE council_floor_requests SET status='granted', updated_at=? WHERE id=? AND session_id=?`,
 		now, requestID, sessionID,
 	); err != nil {
 		return 0, "", err
 	}
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
 		sessionID, topicID, "moderator", "floor_granted", fmt.Sprintf("Floor granted to %s", role), now,
 	); err != nil {
@@ -631,7 +515,7 @@ func (c *councilStore) publishStatement(sessionID string, requestID int64, conte
 		return 0, nil, fmt.Errorf("floor request %d is not granted", requestID)
 	}
 
-	tx, err := c.db.Begin()
+	tx, err := beginTx(c.db)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -710,7 +594,7 @@ func (c *councilStore) respondTopic(sessionID string, topicID int64, role, decis
 		return false, nil, fmt.Errorf("topic %d is not open", topicID)
 	}
 	now := nowRFC3339()
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_topic_votes(session_id,topic_id,role,decision,updated_at)
 		 VALUES(?,?,?,?,?)
 		 ON CONFLICT(session_id,topic_id,role) DO UPDATE SET decision=excluded.decision, updated_at=excluded.updated_at`,
@@ -722,7 +606,7 @@ func (c *councilStore) respondTopic(sessionID string, topicID int64, role, decis
 	if normalized == "raise" {
 		action = "topic_raise"
 	}
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
 		sessionID, topicID, role, action, content, now,
 	); err != nil {
@@ -833,13 +717,13 @@ func (c *councilStore) closeTopic(sessionID string, topicID int64) (int, error)
 	}
 
 	now := nowRFC3339()
-	if _, err = c.db.Exec(
+	if _, err = execRetry(c.db,
 		`UPDATE council_topics SET status='closed', updated_at=? WHERE session_id=? AND id=?`,
 		now, sessionID, topicID,
 	); err != nil {
 		return 0, err
 	}
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
 		sessionID, topicID, "moderator", "topic_closed", "Topic closed", now,
 	); err != nil {
@@ -868,13 +752,13 @@ func (c *councilStore) finalizeConsensus(sessionID string) error {
 		return fmt.Errorf("cannot finalize with %d open topics", openCount)
 	}
 	now := nowRFC3339()
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`UPDATE council_sessions SET status='consensus_reached', phase='finalized', updated_at=? WHERE session_id=?`,
 		now, sessionID,
 	); err != nil {
 		return err
 	}
-	if _, err := c.db.Exec(
+	if _, err := execRetry(c.db,
 		`INSERT INTO council_messages(session_id,topic_id,role,action,content,created_at) VALUES(?,?,?,?,?,?)`,
 		sessionID, 0, "moderator", "consensus_finalized", "Consensus finalized for all topics", now,
 	); err != nil {
@@ -1003,3 +887,192 @@ func (c *councilStore) getSessionMeta(sessionID string) (string, string, string,
 	}
 	return status, phase, summary, nil
 }
+
+// councilSessionTables holds every council table keyed by session_id.
+var councilSessionTables = []string{
+	"council_sessions",
+	"council_roles",
+	"council_topics",
+	"council_floor_requests",
+	"council_topic_votes",
+	"council_messages",
+	"council_proposals",
+}
+
+// councilTableRows is a table's rows for one session, column by column.
+type councilTableRows struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// sessionRows captures every council row of a session so it can be put
+// back by restoreSessionRows.
+func (c *councilStore) sessionRows(sessionID string) (json.RawMessage, error) {
+	tables, err := c.sessionTableRows(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tables)
+}
+
+func (c *councilStore) sessionTableRows(sessionID string) (map[string]councilTableRows, error) {
+	out := map[string]councilTableRows{}
+	for _, table := range councilSessionTables {
+		rows, err := c.db.Query(`SELECT * FROM `+table+` WHERE session_id=?`, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		data := councilTableRows{Columns: columns, Rows: [][]any{}}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			for i, v := range values {
+				if b, ok := v.([]byte); ok {
+					values[i] = string(b)
+				}
+			}
+			data.Rows = append(data.Rows, values)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		out[table] = data
+	}
+	return out, nil
+}
+
+func insertRowStatement(table string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = `"` + strings.ReplaceAll(column, `"`, `""`) + `"`
+	}
+	return `INSERT INTO ` + table + `(` + strings.Join(quoted, ",") + `) VALUES(?` + strings.Repeat(",?", len(columns)-1) + `)`
+}
+
+// restoreSessionRows replaces a session's council rows with ones captured by
+// sessionRows, in one transaction.
+func (c *councilStore) restoreSessionRows(sessionID string, raw json.RawMessage) (err error) {
+	tables := map[string]councilTableRows{}
+	if len(raw) > 0 {
+		dec := json.NewDecoder(strings.NewReader(string(raw)))
+		dec.UseNumber()
+		if err := dec.Decode(&tables); err != nil {
+			return fmt.Errorf("invalid council snapshot: %w", err)
+		}
+	}
+	tx, err := beginTx(c.db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	for _, table := range councilSessionTables {
+		if _, err = tx.Exec(`DELETE FROM `+table+` WHERE session_id=?`, sessionID); err != nil {
+			return err
+		}
+		data := tables[table]
+		if len(data.Rows) == 0 {
+			continue
+		}
+		insert := insertRowStatement(table, data.Columns)
+		for _, row := range data.Rows {
+			args := make([]any, len(row))
+			for i, v := range row {
+				args[i] = snapshotValue(v)
+			}
+			if _, err = tx.Exec(insert, args...); err != nil {
+				return fmt.Errorf("restoring %s: %w", table, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// copySessionRows copies a session's council rows to another session. Rows
+// get new IDs, and topic references are pointed at the copied topics.
+func (c *councilStore) copySessionRows(fromID, toID string) (err error) {
+	tables, err := c.sessionTableRows(fromID)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTx(c.db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	topicIDs := map[int64]int64{}
+	for _, table := range councilSessionTables {
+		data := tables[table]
+		for _, row := range data.Rows {
+			var columns []string
+			var args []any
+			var oldID int64
+			for i, column := range data.Columns {
+				value := row[i]
+				switch column {
+				case "id":
+					oldID, _ = value.(int64)
+					continue
+				case "session_id":
+					value = toID
+				case "topic_id":
+					if id, ok := value.(int64); ok {
+						if mapped, ok := topicIDs[id]; ok {
+							value = mapped
+						}
+					}
+				}
+				columns = append(columns, column)
+				args = append(args, value)
+			}
+			res, execErr := tx.Exec(insertRowStatement(table, columns), args...)
+			if err = execErr; err != nil {
+				return fmt.Errorf("copying %s: %w", table, err)
+			}
+			if table == "council_topics" {
+				if topicIDs[oldID], err = res.LastInsertId(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// snapshotValue turns a decoded JSON number back into the SQLite integer or
+// real it was captured from.
+func snapshotValue(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// deleteSessionRows removes every council row of a session.
+func (c *councilStore) deleteSessionRows(sessionID string) error {
+	return c.restoreSessionRows(sessionID, nil)
+}
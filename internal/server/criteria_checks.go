@@ -0,0 +1,232 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	criterionPass       = "pass"
+	criterionFail       = "fail"
+	criterionUnverified = "unverified"
+)
+
+// matchCriterion returns the approved criterion a check names: an exact
+// match first, else one matching as criterionCovered does.
+func matchCriterion(session *SessionState, name string) (string, bool) {
+	want := normalizeToken(name)
+	if want == "" {
+		return "", false
+	}
+	for _, c := range session.ApprovedCriteria {
+		if normalizeToken(c) == want {
+			return c, true
+		}
+	}
+	for _, c := range session.ApprovedCriteria {
+		if normalizeToken(c) != "" && criterionCovered(c, []string{name}) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func criterionCheckKey(check CriterionCheck) string {
+	return strings.Join([]string{
+		check.Criterion,
+		check.Command,
+		fmt.Sprint(check.ExpectExitCode),
+		strings.Join(check.OutputContains, "\x00"),
+		strings.Join(check.OutputExcludes, "\x00"),
+	}, "\x01")
+}
+
+// bindCriterionChecks validates explicit checks and adds the verify
+// commands of plan items as exit-0 checks of the criteria each item
+// covers. It returns the problems with the explicit checks and, separately,
+// the approved criteria left without a check.
+func bindCriterionChecks(session *SessionState, explicit []CriterionCheck, allowedCommands []string) (checks []CriterionCheck, problems, unbound []string) {
+	checks = []CriterionCheck{}
+	problems = []string{}
+	unbound = []string{}
+	seen := map[string]bool{}
+	add := func(check CriterionCheck) {
+		if key := criterionCheckKey(check); !seen[key] {
+			seen[key] = true
+			checks = append(checks, check)
+		}
+	}
+	for _, check := range explicit {
+		check.Command = strings.TrimSpace(check.Command)
+		check.OutputContains = normalizeStringList(check.OutputContains)
+		check.OutputExcludes = normalizeStringList(check.OutputExcludes)
+		criterion, ok := matchCriterion(session, check.Criterion)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("check %q names unknown success criterion %q", check.Command, check.Criterion))
+			continue
+		}
+		if !isAllowedCommand(check.Command, allowedCommands) {
+			problems = append(problems, fmt.Sprintf("check command not allowed: %s", check.Command))
+			continue
+		}
+		check.Criterion = criterion
+		add(check)
+	}
+	if session.Plan != nil {
+		for _, item := range session.Plan.Items {
+			for _, criterion := range session.ApprovedCriteria {
+				if normalizeToken(criterion) == "" || !criterionCovered(criterion, item.Criteria) {
+					continue
+				}
+				for _, cmd := range item.Verify {
+					add(CriterionCheck{Criterion: criterion, Command: cmd, OutputContains: []string{}, OutputExcludes: []string{}})
+				}
+			}
+		}
+	}
+	for _, criterion := range session.ApprovedCriteria {
+		bound := false
+		for _, check := range checks {
+			bound = bound || check.Criterion == criterion
+		}
+		if !bound {
+			unbound = append(unbound, criterion)
+		}
+	}
+	return checks, problems, unbound
+}
+
+// unboundProblems describes approved criteria left without a check.
+func unboundProblems(unbound []string) []string {
+	out := make([]string, 0, len(unbound))
+	for _, criterion := range unbound {
+		out = append(out, fmt.Sprintf("success criterion %q has no verification check", criterion))
+	}
+	return out
+}
+
+// checkCommands lists the distinct commands of the bound checks in order,
+// so a command shared by several checks runs once.
+func checkCommands(checks []CriterionCheck) []string {
+	out := []string{}
+	for _, check := range checks {
+		if !containsString(out, check.Command) {
+			out = append(out, check.Command)
+		}
+	}
+	return out
+}
+
+// evaluateCheck judges a check against its command's result. Output
+// assertions see the redacted output, and the result names the redacted
+// command.
+func evaluateCheck(check CriterionCheck, res CommandResult) CheckResult {
+	out := CheckResult{Command: res.Command, ExpectExitCode: check.ExpectExitCode, ExitCode: res.ExitCode, Passed: true}
+	output := res.Stdout + "\n" + res.Stderr
+	if res.ExitCode != check.ExpectExitCode {
+		out.Passed = false
+		out.Reason = fmt.Sprintf("exit code %d, expected %d", res.ExitCode, check.ExpectExitCode)
+		return out
+	}
+	for _, want := range check.OutputContains {
+		if !strings.Contains(output, want) {
+			out.Passed = false
+			out.Reason = fmt.Sprintf("output does not contain %q", want)
+			return out
+		}
+	}
+	for _, unwanted := range check.OutputExcludes {
+		if strings.Contains(output, unwanted) {
+			out.Passed = false
+			out.Reason = fmt.Sprintf("output contains %q", unwanted)
+			return out
+		}
+	}
+	return out
+}
+
+// criteriaReport evaluates the bound checks against the results of their
+// commands. A criterion passes when all its checks ran and passed, fails
+// when any ran and failed, and is otherwise unverified.
+func criteriaReport(session *SessionState, results map[string]CommandResult) []CriterionResult {
+	report := []CriterionResult{}
+	for _, criterion := range session.ApprovedCriteria {
+		row := CriterionResult{Criterion: criterion, Status: criterionUnverified, Checks: []CheckResult{}}
+		total, failed := 0, false
+		for _, check := range session.CriterionChecks {
+			if check.Criterion != criterion {
+				continue
+			}
+			total++
+			res, ok := results[check.Command]
+			if !ok || res.Status == commandStatusCancelled {
+				continue
+			}
+			result := evaluateCheck(check, res)
+			row.Checks = append(row.Checks, result)
+			failed = failed || !result.Passed
+		}
+		switch {
+		case failed:
+			row.Status = criterionFail
+		case total > 0 && len(row.Checks) == total:
+			row.Status = criterionPass
+		}
+		report = append(report, row)
+	}
+	return report
+}
+
+// criteriaWithStatus lists the report's criteria with a status, with the
+// first failing check's reason for failed ones.
+func criteriaWithStatus(report []CriterionResult, status string) []string {
+	out := []string{}
+	for _, row := range report {
+		if row.Status != status {
+			continue
+		}
+		entry := row.Criterion
+		for _, check := range row.Checks {
+			if !check.Passed {
+				entry = fmt.Sprintf("%s (%s: %s)", row.Criterion, check.Command, check.Reason)
+				break
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// unverifiedCriteria lists approved criteria that have not passed their
+// checks in the latest verification.
+func unverifiedCriteria(session *SessionState) []string {
+	passed := map[string]bool{}
+	for _, row := range session.CriteriaReport {
+		passed[row.Criterion] = row.Status == criterionPass
+	}
+	out := []string{}
+	for _, criterion := range session.ApprovedCriteria {
+		if !passed[criterion] {
+			out = append(out, criterion)
+		}
+	}
+	return out
+}
+
+// criteriaChecksSchema is the input schema of criteria_checks, shared by
+// approve_plan and verify_result.
+var criteriaChecksSchema = map[string]any{
+	"type":        "array",
+	"description": "Checks binding success criteria to commands; item verify commands count as exit-0 checks of the criteria the item covers",
+	"items": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"criterion":        map[string]any{"type": "string"},
+			"command":          map[string]any{"type": "string", "description": "Allowed command to run"},
+			"expect_exit_code": map[string]any{"type": "number", "description": "Expected exit code; defaults to 0"},
+			"output_contains":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Text the output must contain"},
+			"output_excludes":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Text the output must not contain"},
+		},
+		"required": []string{"criterion", "command"},
+	},
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clientCallTimeout bounds how long a server-initiated request waits for
+// the client. Elicitations wait on a human, so it is generous.
+const clientCallTimeout = 10 * time.Minute
+
+const (
+	// decidedByUser marks answers the human gave through elicitation.
+	decidedByUser = "user"
+	// decidedByAgent marks answers relayed by the agent in tool arguments.
+	decidedByAgent = "agent"
+)
+
+var errClientUnreachable = errors.New("client cannot receive server requests")
+
+type jsonRPCServerRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      string `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// callClient sends a request to the client that issued the current call and
+// waits for its response.
+func (s *MCPServer) callClient(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	ch, ok := clientChannelFromContext(ctx)
+	if !ok {
+		return nil, errClientUnreachable
+	}
+	reply := make(chan jsonRPCRequest, 1)
+	s.mu.Lock()
+	s.clientCallSeq++
+	id := fmt.Sprintf("troller-%d", s.clientCallSeq)
+	key := requestKey(ctx, id)
+	s.clientCalls[key] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clientCalls, key)
+		s.mu.Unlock()
+	}()
+
+	if !ch.send(jsonRPCServerRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params}) {
+		// Over HTTP without a GET stream a JSON response has nowhere to
+		// carry the request.
+		return nil, errClientUnreachable
+	}
+	timer := time.NewTimer(clientCallTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-reply:
+		if resp.Error != nil {
+			return nil, fmt.Errorf("client rejected %s: %s", method, resp.Error.Message)
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		ch.send(jsonRPCNotification{JSONRPC: "2.0", Method: "notifications/cancelled", Params: map[string]any{"requestId": id, "reason": "tool call cancelled"}})
+		return nil, ctx.Err()
+	case <-ch.gone:
+		return nil, errClientUnreachable
+	case <-timer.C:
+		ch.send(jsonRPCNotification{JSONRPC: "2.0", Method: "notifications/cancelled", Params: map[string]any{"requestId": id, "reason": "timed out"}})
+		return nil, fmt.Errorf("client did not answer %s within %s", method, clientCallTimeout)
+	}
+}
+
+// deliverClientResponse routes a client response to the waiting callClient.
+func (s *MCPServer) deliverClientResponse(ctx context.Context, resp jsonRPCRequest) {
+	key := requestKey(ctx, resp.ID)
+	s.mu.Lock()
+	reply, ok := s.clientCalls[key]
+	s.mu.Unlock()
+	if !ok {
+		s.logger.Warn("response to unknown server request", "request_id", key)
+		return
+	}
+	select {
+	case reply <- resp:
+	default:
+	}
+}
+
+type elicitResult struct {
+	Action  string         `json:"action"`
+	Content map[string]any `json:"content"`
+}
+
+func (r elicitResult) accepted() bool {
+	return r.Action == "accept"
+}
+
+func (r elicitResult) text(field string) string {
+	value, _ := r.Content[field].(string)
+	return strings.TrimSpace(value)
+}
+
+// lines splits a multi-line text answer; elicitation schemas cannot carry
+// arrays, so list answers are entered one item per line.
+func (r elicitResult) lines(field string) []string {
+	var out []string
+	for _, line := range strings.Split(r.text(field), "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-")); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// canElicit reports whether the calling client declared elicitation and can
+// be reached with a server request.
+func (s *MCPServer) canElicit(ctx context.Context) bool {
+	client, ok := s.clientFor(ctx)
+	if !ok || client.Capabilities.Elicitation == nil {
+		return false
+	}
+	_, ok = clientChannelFromContext(ctx)
+	return ok
+}
+
+// elicit asks the human through elicitation/create. asked is false when the
+// client does not support elicitation or cannot be reached, and the caller
+// should fall back to the tool arguments. The session lock is released while
+// the human answers.
+func (s *MCPServer) elicit(ctx context.Context, message string, schema map[string]any) (result elicitResult, asked bool, err error) {
+	if !s.canElicit(ctx) {
+		return elicitResult{}, false, nil
+	}
+	var raw json.RawMessage
+	if waitErr := s.waitUnlocked(ctx, func() {
+		raw, err = s.callClient(ctx, "elicitation/create", map[string]any{
+			"message":         message,
+			"requestedSchema": schema,
+		})
+	}); waitErr != nil {
+		return elicitResult{}, true, waitErr
+	}
+	if errors.Is(err, errClientUnreachable) {
+		return elicitResult{}, false, nil
+	}
+	if err != nil {
+		return elicitResult{}, true, err
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return elicitResult{}, true, fmt.Errorf("invalid elicitation result: %w", err)
+	}
+	return result, true, nil
+}
+
+// recordUserDecision appends an approval-gate answer to the session history.
+func recordUserDecision(session *SessionState, gate, decision, decidedBy, notes string) {
+	session.UserDecisions = append(session.UserDecisions, UserDecision{
+		Gate:      gate,
+		Decision:  decision,
+		DecidedBy: decidedBy,
+		Notes:     strings.TrimSpace(notes),
+		At:        time.Now().UTC(),
+	})
+}
+
+// elicitationDeclined is the tool failure returned when the human dismisses
+// an approval request; the session is left unchanged.
+func elicitationDeclined(session *SessionState, gate string, result elicitResult) *toolFailure {
+	return &toolFailure{
+		SessionID: session.SessionID,
+		Step:      session.Step,
+		NextStep:  gate,
+		Reason:    fmt.Sprintf("user did not answer the %s request (%s)", gate, result.Action),
+	}
+}
+
+func (s *MCPServer) elicitPlanApproval(ctx context.Context, session *SessionState) (elicitResult, bool, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Approve the plan for: %s\n", strings.TrimSpace(session.Intent.Goal))
+	if session.Plan != nil {
+		for i, item := range session.Plan.Items {
+			fmt.Fprintf(&b, "%d. [%s] %s (%s)\n", i+1, item.ID, item.Title, item.Owner)
+		}
+	}
+	if session.Mockup != nil {
+		fmt.Fprintf(&b, "Mockup v%d: %s\n", session.Mockup.Version, session.Mockup.Summary)
+	}
+	return s.elicit(ctx, b.String(), map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"decision": map[string]any{
+				"type":      "string",
+				"title":     "Decision",
+				"enum":      []string{"approve", "reject"},
+				"enumNames": []string{"Approve", "Reject"},
+			},
+			"required_fixes": map[string]any{
+				"type":        "string",
+				"title":       "Required fixes",
+				"description": "When rejecting, one fix per line",
+			},
+			"notes": map[string]any{"type": "string", "title": "Notes"},
+		},
+		"required": []string{"decision"},
+	})
+}
+
+func (s *MCPServer) elicitUserFeedback(ctx context.Context, session *SessionState) (elicitResult, bool, error) {
+	message := "Review the verification results and approve the outcome, or list the fixes you need."
+	if session.Step == StepMockupReady {
+		message = "Review the mockup and approve it, or list the changes you need."
+		if session.Mockup != nil {
+			message += fmt.Sprintf("\nMockup v%d: %s", session.Mockup.Version, session.Mockup.Summary)
+		}
+	}
+	return s.elicit(ctx, message, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"approved": map[string]any{"type": "boolean", "title": "Approve"},
+			"feedback": map[string]any{"type": "string", "title": "Feedback"},
+			"required_fixes": map[string]any{
+				"type":        "string",
+				"title":       "Required fixes",
+				"description": "One fix per line",
+			},
+		},
+		"required": []string{"approved"},
+	})
+}
+
+func (s *MCPServer) elicitReconcileChoice(ctx context.Context, driftLevel, driftReason string) (elicitResult, bool, error) {
+	message := fmt.Sprintf("The repository changed since this session was saved (drift %s: %s). Keep the saved context or restart the session from scratch?", driftLevel, driftReason)
+	return s.elicit(ctx, message, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"choice": map[string]any{
+				"type":      "string",
+				"title":     "Session context",
+				"enum":      []string{"keep_context", "restart_context"},
+				"enumNames": []string{"Keep context", "Restart context"},
+			},
+		},
+		"required": []string{"choice"},
+	})
+}
+
+func (s *MCPServer) elicitClarifyAnswer(ctx context.Context, decision clarifyDecision) (elicitResult, bool, error) {
+	return s.elicit(ctx, decision.Question, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"answer": map[string]any{
+				"type":        "string",
+				"title":       decision.QuestionTopic,
+				"description": decision.QuestionReason,
+			},
+		},
+		"required": []string{"answer"},
+	})
+}
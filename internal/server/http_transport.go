@@ -0,0 +1,525 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	httpEndpointPath  = "/mcp"
+	httpSessionHeader = "Mcp-Session-Id"
+	httpMaxBodyBytes  = 16 << 20
+	// httpStreamBuffer bounds queued server-initiated messages per client;
+	// messages beyond it are dropped rather than stalling tool calls.
+	httpStreamBuffer = 64
+	// httpClientIdleTimeout expires transport sessions of clients that went
+	// away without a DELETE: no open stream, no request in flight and no
+	// message for this long.
+	httpClientIdleTimeout = 30 * time.Minute
+)
+
+// RunHTTP serves MCP over the streamable HTTP transport until ctx is done.
+// addr is a loopback host:port or "unix:/path/to.sock".
+func (s *MCPServer) RunHTTP(ctx context.Context, addr string) error {
+	ln, err := listenHTTP(addr)
+	if err != nil {
+		return err
+	}
+	httpSrv := &http.Server{
+		Handler:           s.httpHandler(ctx),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpSrv.Shutdown(shutdownCtx)
+	}()
+	s.logger.Info("serving MCP over HTTP", "addr", ln.Addr().String(), "path", httpEndpointPath)
+	if err := httpSrv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func listenHTTP(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			// Stale socket left by a previous process.
+			_ = os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0o600); err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http address %q: %w", addr, err)
+	}
+	if !isLoopbackHost(host) {
+		return nil, fmt.Errorf("http transport only binds loopback addresses, got %q", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpTransport implements the MCP streamable HTTP transport on a single
+// endpoint: POST carries client messages, GET opens an SSE stream for
+// server-initiated messages and DELETE ends the transport session.
+type httpTransport struct {
+	srv *MCPServer
+	// ctx bounds request handling; a dropped HTTP connection is not a
+	// cancellation, so requests run on the server context instead.
+	ctx         context.Context
+	mu          sync.Mutex
+	clients     map[string]*httpClient
+	idleTimeout time.Duration
+}
+
+// httpClient is one transport session, identified by Mcp-Session-Id. It is
+// unrelated to workflow sessions, which any client may address.
+type httpClient struct {
+	id       string
+	mu       sync.Mutex
+	stream   chan []byte
+	closed   chan struct{}
+	active   int
+	lastSeen time.Time
+}
+
+func (s *MCPServer) httpHandler(ctx context.Context) http.Handler {
+	return &httpTransport{srv: s, ctx: ctx, clients: map[string]*httpClient{}, idleTimeout: httpClientIdleTimeout}
+}
+
+func (t *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != httpEndpointPath {
+		http.NotFound(w, r)
+		return
+	}
+	if !isAllowedOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "forbidden origin", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r)
+	case http.MethodGet:
+		t.handleGet(w, r)
+	case http.MethodDelete:
+		t.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// isAllowedOrigin guards against DNS rebinding: browsers always send Origin,
+// and only local pages may talk to the server.
+func isAllowedOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return isLoopbackHost(u.Hostname())
+}
+
+func (t *httpTransport) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBodyBytes))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	reqs, batch, err := decodeHTTPMessages(body)
+	if err != nil {
+		writeHTTPJSON(w, http.StatusBadRequest, jsonRPCResponse{JSONRPC: "2.0", ID: nil, Error: &rpcError{Code: -32700, Message: "parse error"}})
+		return
+	}
+
+	var client *httpClient
+	for _, req := range reqs {
+		if req.Method == "initialize" {
+			client = t.newClient()
+			w.Header().Set(httpSessionHeader, client.id)
+			break
+		}
+	}
+	if client == nil {
+		var status int
+		client, status = t.lookupClient(r)
+		if client == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	hasRequests := false
+	for _, req := range reqs {
+		if req.ID != nil && !req.isResponse() {
+			hasRequests = true
+			break
+		}
+	}
+	if !hasRequests {
+		for _, req := range reqs {
+			t.dispatch(client, req, client.sendMessage)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if acceptsEventStream(r) {
+		t.respondEventStream(w, client, reqs)
+		return
+	}
+
+	// Plain JSON responses cannot carry notifications, so route them to the
+	// client's GET stream if one is open.
+	responses := t.dispatchAll(client, reqs, client.sendMessage)
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeHTTPJSON(w, http.StatusOK, responses)
+	default:
+		writeHTTPJSON(w, http.StatusOK, responses[0])
+	}
+}
+
+// respondEventStream answers a POST with an SSE stream that carries the
+// notifications raised while handling it, followed by the responses.
+func (t *httpTransport) respondEventStream(w http.ResponseWriter, client *httpClient, reqs []jsonRPCRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var writeMu sync.Mutex
+	write := func(msg any) bool {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			t.srv.logger.Error("message marshal failed", "error", err)
+			return false
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := writeSSEEvent(w, payload); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	var wg sync.WaitGroup
+	for _, req := range reqs {
+		wg.Add(1)
+		go func(req jsonRPCRequest) {
+			defer wg.Done()
+			if resp, ok := t.dispatch(client, req, write); ok {
+				write(resp)
+			}
+		}(req)
+	}
+	wg.Wait()
+}
+
+func (t *httpTransport) dispatchAll(client *httpClient, reqs []jsonRPCRequest, send func(msg any) bool) []jsonRPCResponse {
+	responses := make([]*jsonRPCResponse, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req jsonRPCRequest) {
+			defer wg.Done()
+			if resp, ok := t.dispatch(client, req, send); ok {
+				responses[i] = &resp
+			}
+		}(i, req)
+	}
+	wg.Wait()
+	out := make([]jsonRPCResponse, 0, len(reqs))
+	for _, resp := range responses {
+		if resp != nil {
+			out = append(out, *resp)
+		}
+	}
+	return out
+}
+
+// dispatch handles one client message. send carries the notifications and
+// server-initiated requests raised while handling it.
+func (t *httpTransport) dispatch(client *httpClient, req jsonRPCRequest, send func(msg any) bool) (jsonRPCResponse, bool) {
+	ctx := withClientNotifier(withRequestScope(t.ctx, client.id), client.send)
+	if req.isResponse() {
+		t.srv.deliverClientResponse(ctx, req)
+		return jsonRPCResponse{}, false
+	}
+	client.begin()
+	defer client.end()
+	reqCtx, finish := t.srv.trackRequest(withClientChannel(ctx, send, client.closed), req.ID)
+	return t.srv.runTracked(reqCtx, finish, req, func(method string, params any) {
+		send(jsonRPCNotification{JSONRPC: "2.0", Method: method, Params: params})
+	})
+}
+
+func (t *httpTransport) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	client, status := t.lookupClient(r)
+	if client == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	stream, ok := client.openStream()
+	if !ok {
+		http.Error(w, "stream already open for session", http.StatusConflict)
+		return
+	}
+	client.begin()
+	defer client.end()
+	defer client.closeStream(stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-r.Context().Done():
+			return
+		case <-client.closed:
+			return
+		case payload := <-stream:
+			if err := writeSSEEvent(w, payload); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (t *httpTransport) handleDelete(w http.ResponseWriter, r *http.Request) {
+	client, status := t.lookupClient(r)
+	if client == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if !t.removeClient(client) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// removeClient ends a transport session. Only the call that removes the
+// client closes it, so concurrent DELETEs or expiry cannot close the
+// channel twice.
+func (t *httpTransport) removeClient(client *httpClient) bool {
+	t.mu.Lock()
+	removed := t.clients[client.id] == client
+	delete(t.clients, client.id)
+	t.mu.Unlock()
+	if !removed {
+		return false
+	}
+	t.srv.forgetClient(client.id)
+	close(client.closed)
+	return true
+}
+
+// expireIdleClients removes the clients idle for longer than idleTimeout.
+// It runs whenever a client is created, so the map stays bounded by the
+// clients seen within the timeout.
+func (t *httpTransport) expireIdleClients() {
+	cutoff := time.Now().Add(-t.idleTimeout)
+	var idle []*httpClient
+	t.mu.Lock()
+	for _, client := range t.clients {
+		if client.idleSince(cutoff) {
+			idle = append(idle, client)
+		}
+	}
+	t.mu.Unlock()
+	for _, client := range idle {
+		if t.removeClient(client) {
+			t.srv.logger.Info("expired idle http client", "client", client.id)
+		}
+	}
+}
+
+func (t *httpTransport) newClient() *httpClient {
+	t.expireIdleClients()
+	client := &httpClient{id: randomID(), closed: make(chan struct{}), lastSeen: time.Now()}
+	t.mu.Lock()
+	t.clients[client.id] = client
+	t.mu.Unlock()
+	return client
+}
+
+// lookupClient resolves the Mcp-Session-Id header. A missing header is a
+// bad request; an unknown one tells the client to initialize again.
+func (t *httpTransport) lookupClient(r *http.Request) (*httpClient, int) {
+	id := strings.TrimSpace(r.Header.Get(httpSessionHeader))
+	if id == "" {
+		return nil, http.StatusBadRequest
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	client, ok := t.clients[id]
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	client.touch()
+	return client, http.StatusOK
+}
+
+func (c *httpClient) touch() {
+	c.mu.Lock()
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+}
+
+// begin and end bracket a request or an open GET stream, during which the
+// client is never idle.
+func (c *httpClient) begin() {
+	c.mu.Lock()
+	c.active++
+	c.mu.Unlock()
+}
+
+func (c *httpClient) end() {
+	c.mu.Lock()
+	c.active--
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *httpClient) idleSince(cutoff time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active == 0 && c.stream == nil && c.lastSeen.Before(cutoff)
+}
+
+func (c *httpClient) openStream() (chan []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream != nil {
+		return nil, false
+	}
+	c.stream = make(chan []byte, httpStreamBuffer)
+	return c.stream, true
+}
+
+func (c *httpClient) closeStream(stream chan []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream == stream {
+		c.stream = nil
+	}
+}
+
+// send queues a notification on the client's GET stream.
+func (c *httpClient) send(method string, params any) {
+	c.sendMessage(jsonRPCNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// sendMessage queues any JSON-RPC message on the client's GET stream and
+// reports whether it was queued. Without an open stream, or when the client
+// falls behind, the message is dropped.
+func (c *httpClient) sendMessage(msg any) bool {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream == nil {
+		return false
+	}
+	select {
+	case c.stream <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+func decodeHTTPMessages(body []byte) ([]jsonRPCRequest, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []jsonRPCRequest
+		if err := json.Unmarshal(trimmed, &reqs); err != nil {
+			return nil, true, err
+		}
+		if len(reqs) == 0 {
+			return nil, true, fmt.Errorf("empty batch")
+		}
+		return reqs, true, nil
+	}
+	var req jsonRPCRequest
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return nil, false, err
+	}
+	return []jsonRPCRequest{req}, false, nil
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeSSEEvent(w io.Writer, payload []byte) error {
+	_, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", payload)
+	return err
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
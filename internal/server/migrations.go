@@ -0,0 +1,335 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the state database or a stored session
+// was written by a newer codex-mcp than this binary.
+var ErrSchemaTooNew = errors.New("state schema is newer than this codex-mcp supports")
+
+// schemaMigration is one ordered step of the council.db schema. Migrations
+// run once each, in their own transaction, and are recorded in
+// schema_migrations. Databases created before migrations existed already
+// hold some of these tables, so steps tolerate objects that exist.
+type schemaMigration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx) error
+}
+
+var councilMigrations = []schemaMigration{
+	{version: 1, name: "council tables", apply: execStatements(
+		`CREATE TABLE IF NOT EXISTS council_sessions (
+			session_id TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			phase TEXT NOT NULL,
+			summary TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS council_roles (
+			session_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			domain TEXT NOT NULL DEFAULT 'general',
+			model TEXT NOT NULL,
+			brief TEXT NOT NULL DEFAULT '',
+			priority TEXT NOT NULL DEFAULT '',
+			contribution TEXT NOT NULL DEFAULT '',
+			quick_decisions TEXT NOT NULL DEFAULT '',
+			brief_submitted INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY(session_id, role)
+		);`,
+		`CREATE TABLE IF NOT EXISTS council_topics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT NOT NULL,
+			topic_key TEXT NOT NULL,
+			title TEXT NOT NULL,
+			detail TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'open',
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_council_topic_unique ON council_topics(session_id, topic_key);`,
+		`CREATE TABLE IF NOT EXISTS council_floor_requests (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT NOT NULL,
+			topic_id INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			status TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS council_topic_votes (
+			session_id TEXT NOT NULL,
+			topic_id INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			decision TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY(session_id, topic_id, role)
+		);`,
+		`CREATE TABLE IF NOT EXISTS council_messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT NOT NULL,
+			topic_id INTEGER NOT NULL DEFAULT 0,
+			role TEXT NOT NULL,
+			action TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS council_proposals (
+			session_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			domain TEXT NOT NULL,
+			summary TEXT NOT NULL,
+			options_json TEXT NOT NULL DEFAULT '[]',
+			recommended TEXT NOT NULL DEFAULT '',
+			user_decision TEXT NOT NULL DEFAULT '',
+			user_feedback TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY(session_id, version)
+		);`,
+	)},
+	{version: 2, name: "council_roles.domain", apply: func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "council_roles", "domain", `TEXT NOT NULL DEFAULT 'general'`)
+	}},
+	{version: 3, name: "session tables", apply: execStatements(
+		`CREATE TABLE IF NOT EXISTS sessions (
+			session_id TEXT PRIMARY KEY,
+			step TEXT NOT NULL,
+			state_json TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			revision INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE TABLE IF NOT EXISTS session_step_history (
+			session_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			step TEXT NOT NULL,
+			PRIMARY KEY(session_id, seq)
+		);`,
+		`CREATE TABLE IF NOT EXISTS session_command_results (
+			session_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			command TEXT NOT NULL,
+			exit_code INTEGER NOT NULL,
+			stdout TEXT NOT NULL DEFAULT '',
+			stderr TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY(session_id, kind, seq)
+		);`,
+		`CREATE TABLE IF NOT EXISTS session_feedback (
+			session_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			feedback TEXT NOT NULL,
+			PRIMARY KEY(session_id, seq)
+		);`,
+	)},
+	{version: 4, name: "sessions.revision", apply: func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "sessions", "revision", `INTEGER NOT NULL DEFAULT 0`)
+	}},
+	{version: 5, name: "session snapshots", apply: execStatements(
+		`CREATE TABLE IF NOT EXISTS session_snapshots (
+			session_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			step TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			state_json TEXT NOT NULL,
+			council_json TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			PRIMARY KEY(session_id, seq)
+		);`,
+	)},
+	{version: 6, name: "session_command_results.redactions", apply: func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "session_command_results", "redactions", `INTEGER NOT NULL DEFAULT 0`)
+	}},
+	{version: 7, name: "session_command_results.item_id", apply: func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "session_command_results", "item_id", `TEXT NOT NULL DEFAULT ''`)
+	}},
+	{version: 8, name: "work item leases", apply: execStatements(
+		`CREATE TABLE IF NOT EXISTS work_item_leases (
+			session_id TEXT NOT NULL,
+			item_id TEXT NOT NULL,
+			worker TEXT NOT NULL,
+			token TEXT NOT NULL,
+			claimed_at TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			PRIMARY KEY(session_id, item_id)
+		);`,
+	)},
+	{version: 9, name: "session plan versions", apply: execStatements(
+		`CREATE TABLE IF NOT EXISTS session_plan_versions (
+			session_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			body_json TEXT NOT NULL,
+			PRIMARY KEY(session_id, seq)
+		);`,
+	)},
+}
+
+// latestSchemaVersion is the newest council.db schema this binary knows.
+func latestSchemaVersion() int {
+	return councilMigrations[len(councilMigrations)-1].version
+}
+
+func execStatements(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumnIfMissing adds a column to a table created by an older version.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?`, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// schemaVersion returns the newest migration recorded in the database.
+func schemaVersion(q queryer) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// migrateDatabase applies pending migrations in order. It refuses a
+// database whose schema is newer than this binary instead of writing to it.
+func migrateDatabase(db *sql.DB) error {
+	if _, err := execRetry(db, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	);`); err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := latestSchemaVersion(); current > latest {
+		return fmt.Errorf("%w: database schema version %d, supported up to %d; upgrade codex-mcp", ErrSchemaTooNew, current, latest)
+	}
+	for _, m := range councilMigrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m schemaMigration) (err error) {
+	tx, err := beginTx(db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	// Another process may have applied it since the version was read.
+	var applied int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version=?`, m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return tx.Rollback()
+	}
+	if err = m.apply(tx); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO schema_migrations(version,name,applied_at) VALUES(?,?,?)`, m.version, m.name, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sessionSchemaVersion is the SessionState layout this binary writes.
+const sessionSchemaVersion = 3
+
+// sessionUpgrades[i] upgrades a session from schema version i to i+1.
+var sessionUpgrades = []func(*SessionState){
+	upgradeSessionV0,
+	upgradeSessionV1,
+	upgradeSessionV2,
+}
+
+// upgradeSession brings a stored session up to sessionSchemaVersion.
+func upgradeSession(session *SessionState) error {
+	if session.SchemaVersion > sessionSchemaVersion {
+		return fmt.Errorf("%w: session %s has schema version %d, supported up to %d", ErrSchemaTooNew, session.SessionID, session.SchemaVersion, sessionSchemaVersion)
+	}
+	for session.SchemaVersion < sessionSchemaVersion {
+		sessionUpgrades[session.SchemaVersion](session)
+		session.SchemaVersion++
+	}
+	return nil
+}
+
+// upgradeSessionV0 fills fields that sessions saved before schema versions
+// existed may lack.
+func upgradeSessionV0(session *SessionState) {
+	if len(session.StepHistory) == 0 {
+		session.StepHistory = []WorkStep{session.Step}
+	}
+	if session.MaxFixLoops <= 0 {
+		session.MaxFixLoops = 5
+	}
+	if session.TopicDecisions == nil {
+		session.TopicDecisions = map[string]string{}
+	}
+	ensureRoutingPolicyDefaults(session)
+	ensureCouncilManagerDefaults(session)
+	ensureConsultantLanguageDefaults(session)
+	ensureVisualReviewDefaults(session)
+}
+
+// upgradeSessionV1 gives plans made before work items existed the default
+// item. Their steps were the same generic text for every goal.
+func upgradeSessionV1(session *SessionState) {
+	if session.Plan != nil && len(session.Plan.Items) == 0 {
+		session.Plan.Items = defaultPlanItems(session)
+	}
+}
+
+// upgradeSessionV2 starts the plan history of sessions that had a plan
+// before versions were kept, with their current plan as version 1.
+func upgradeSessionV2(session *SessionState) {
+	if session.Plan == nil || len(session.PlanVersions) > 0 {
+		return
+	}
+	session.Plan.Version = 1
+	if session.Mockup != nil {
+		session.Mockup.PlanVersion = 1
+	}
+	version := PlanVersion{Version: 1, Plan: *session.Plan, Mockup: session.Mockup, Feedback: []string{}, CreatedAt: session.UpdatedAt}
+	if session.PlanApproved {
+		version.Decision = planDecisionApproved
+		session.ApprovedVersion = 1
+	}
+	session.PlanVersions = []PlanVersion{version}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// planItemID is the form of a work item ID: letters, digits, '-', '_' and
+// '.', so items can be named in commands and file names.
+var planItemID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// planCriteria returns the success criteria plan items must cover: the
+// approved ones once the user approved criteria, else the intent's.
+func planCriteria(session *SessionState) []string {
+	if len(session.ApprovedCriteria) > 0 {
+		return session.ApprovedCriteria
+	}
+	return session.Intent.SuccessCriteria
+}
+
+// criterionCovered reports whether any of the item criteria names the
+// criterion, matching as validateApproveInputs does.
+func criterionCovered(criterion string, itemCriteria []string) bool {
+	want := normalizeToken(criterion)
+	if want == "" {
+		return true
+	}
+	for _, c := range itemCriteria {
+		got := normalizeToken(c)
+		if got != "" && (strings.Contains(got, want) || strings.Contains(want, got)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPlanItems is the plan used when the orchestrator supplies no
+// items: one worker item for the goal that covers every criterion.
+func defaultPlanItems(session *SessionState) []PlanItem {
+	title := strings.TrimSpace(session.Intent.Goal)
+	if title == "" {
+		title = "Implement the requested change"
+	}
+	return []PlanItem{{
+		ID:              "item-1",
+		Title:           title,
+		Owner:           "implementation_worker",
+		Files:           []string{},
+		Verify:          []string{},
+		RequirementTags: append([]string{}, session.RequirementTags...),
+		Criteria:        append([]string{}, planCriteria(session)...),
+		DependsOn:       []string{},
+	}}
+}
+
+// normalizePlanItems trims item fields and fills nil lists so stored plans
+// have a stable shape.
+func normalizePlanItems(items []PlanItem) []PlanItem {
+	out := make([]PlanItem, 0, len(items))
+	for _, item := range items {
+		item.ID = strings.TrimSpace(item.ID)
+		item.Title = strings.TrimSpace(item.Title)
+		item.Owner = normalizeExecutionRole(item.Owner)
+		item.Files = normalizeStringList(item.Files)
+		item.Verify = normalizeStringList(item.Verify)
+		item.RequirementTags = normalizeStringList(item.RequirementTags)
+		item.Criteria = normalizeStringList(item.Criteria)
+		item.DependsOn = normalizeStringList(item.DependsOn)
+		out = append(out, item)
+	}
+	return out
+}
+
+// validatePlanItems lists every problem with a set of work items: missing
+// or duplicate IDs, unknown owners, bad file globs, commands outside the
+// allow list, unknown or cyclic dependencies, and success criteria no item
+// covers.
+func validatePlanItems(session *SessionState, items []PlanItem, allowedCommands []string) []string {
+	problems := []string{}
+	if len(items) == 0 {
+		return append(problems, "plan has no items")
+	}
+	managers := map[string]bool{}
+	for _, mgr := range session.CouncilManagers {
+		managers[normalizeCouncilRoleID(mgr.Role)] = true
+	}
+	byID := map[string]PlanItem{}
+	for i, item := range items {
+		label := fmt.Sprintf("items[%d]", i)
+		switch {
+		case item.ID == "":
+			problems = append(problems, label+": id is required")
+		case !planItemID.MatchString(item.ID):
+			problems = append(problems, fmt.Sprintf("%s: id %q may only use letters, digits, '.', '-' and '_'", label, item.ID))
+		case byID[item.ID].ID != "":
+			problems = append(problems, fmt.Sprintf("%s: duplicate id %q", label, item.ID))
+		default:
+			byID[item.ID] = item
+			label = fmt.Sprintf("item %s", item.ID)
+		}
+		if item.Title == "" {
+			problems = append(problems, label+": title is required")
+		}
+		switch {
+		case item.Owner == "":
+			problems = append(problems, label+": owner is required")
+		case !managers[item.Owner] && !isWorkerExecutionRole(item.Owner):
+			problems = append(problems, fmt.Sprintf("%s: owner %q is neither a council manager of this session nor a worker role", label, item.Owner))
+		}
+		for _, glob := range item.Files {
+			if _, err := path.Match(glob, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: bad file glob %q", label, glob))
+			}
+		}
+		for _, cmd := range item.Verify {
+			if !isAllowedCommand(cmd, allowedCommands) {
+				problems = append(problems, fmt.Sprintf("%s: verification command not allowed: %s", label, cmd))
+			}
+		}
+	}
+	for _, item := range items {
+		for _, dep := range item.DependsOn {
+			switch {
+			case dep == item.ID:
+				problems = append(problems, fmt.Sprintf("item %s: depends on itself", item.ID))
+			case byID[dep].ID == "":
+				problems = append(problems, fmt.Sprintf("item %s: depends on unknown item %q", item.ID, dep))
+			}
+		}
+	}
+	if cycle := planItemCycle(items, byID); len(cycle) > 0 {
+		problems = append(problems, "dependency cycle: "+strings.Join(cycle, " -> "))
+	}
+	var itemCriteria []string
+	for _, item := range items {
+		itemCriteria = append(itemCriteria, item.Criteria...)
+	}
+	for _, criterion := range planCriteria(session) {
+		if !criterionCovered(criterion, itemCriteria) {
+			problems = append(problems, fmt.Sprintf("success criterion %q is not covered by any item", criterion))
+		}
+	}
+	return problems
+}
+
+// planItemCycle returns one dependency cycle as a path of item IDs that
+// starts and ends at the same item, or nil. Self and unknown dependencies
+// are reported separately and skipped here.
+func planItemCycle(items []PlanItem, byID map[string]PlanItem) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var stack []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, dep := range byID[id].DependsOn {
+			if dep == id || byID[dep].ID == "" {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i, onStack := range stack {
+					if onStack == dep {
+						return append(append([]string{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return nil
+	}
+	for _, item := range items {
+		if byID[item.ID].ID != "" && state[item.ID] == unvisited {
+			if cycle := visit(item.ID); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// planItemOrder returns item IDs so every item follows its dependencies,
+// keeping the plan's order where dependencies allow. The plan must be
+// valid.
+func planItemOrder(items []PlanItem) []string {
+	position := map[string]int{}
+	pending := map[string]int{}
+	dependents := map[string][]string{}
+	for i, item := range items {
+		position[item.ID] = i
+		pending[item.ID] = len(item.DependsOn)
+		for _, dep := range item.DependsOn {
+			dependents[dep] = append(dependents[dep], item.ID)
+		}
+	}
+	ready := []string{}
+	for _, item := range items {
+		if pending[item.ID] == 0 {
+			ready = append(ready, item.ID)
+		}
+	}
+	order := make([]string, 0, len(items))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return position[ready[i]] < position[ready[j]] })
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, next := range dependents[id] {
+			if pending[next]--; pending[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	planDecisionApproved = "approved"
+	planDecisionRejected = "rejected"
+)
+
+// listDiff is what was added to and removed from a list of strings.
+type listDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// fieldChange is one field of a plan item that differs between versions.
+type fieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type planItemChange struct {
+	ID      string        `json:"id"`
+	Changes []fieldChange `json:"changes"`
+}
+
+type planItemsDiff struct {
+	Added   []PlanItem       `json:"added"`
+	Removed []PlanItem       `json:"removed"`
+	Changed []planItemChange `json:"changed"`
+}
+
+// planDiff compares two plan versions. Items are matched by ID.
+type planDiff struct {
+	From        int           `json:"from"`
+	To          int           `json:"to"`
+	Title       *fieldChange  `json:"title,omitempty"`
+	Items       planItemsDiff `json:"items"`
+	Assumptions listDiff      `json:"assumptions"`
+	Risks       listDiff      `json:"risks"`
+}
+
+// recordPlanVersion numbers a newly generated plan and adds it to the
+// history together with the feedback gathered since the previous version.
+func recordPlanVersion(session *SessionState, plan *Plan) {
+	plan.Version = 1
+	if n := len(session.PlanVersions); n > 0 {
+		plan.Version = session.PlanVersions[n-1].Version + 1
+	}
+	feedback := session.PlanFeedback
+	if feedback == nil {
+		feedback = []string{}
+	}
+	session.PlanVersions = append(session.PlanVersions, PlanVersion{
+		Version:   plan.Version,
+		Plan:      *plan,
+		Feedback:  feedback,
+		CreatedAt: time.Now().UTC(),
+	})
+	session.PlanFeedback = nil
+}
+
+// planVersion returns a stored version by number.
+func planVersion(session *SessionState, version int) (*PlanVersion, bool) {
+	for i := range session.PlanVersions {
+		if session.PlanVersions[i].Version == version {
+			return &session.PlanVersions[i], true
+		}
+	}
+	return nil, false
+}
+
+// currentPlanVersion returns the history entry of the session's plan.
+func currentPlanVersion(session *SessionState) (*PlanVersion, bool) {
+	if session.Plan == nil {
+		return nil, false
+	}
+	return planVersion(session, session.Plan.Version)
+}
+
+// attachMockup stores a mockup with the plan version it illustrates.
+func attachMockup(session *SessionState, mockup *MockupArtifact) {
+	version, ok := currentPlanVersion(session)
+	if !ok {
+		return
+	}
+	mockup.PlanVersion = version.Version
+	copied := *mockup
+	version.Mockup = &copied
+}
+
+// notePlanFeedback keeps rejection feedback for the next plan version.
+func notePlanFeedback(session *SessionState, feedback ...string) {
+	session.PlanFeedback = mergeUniqueStrings(session.PlanFeedback, normalizeStringList(feedback)...)
+}
+
+// planVersionSummaries lists the history without the full plans.
+func planVersionSummaries(session *SessionState) []map[string]any {
+	out := make([]map[string]any, 0, len(session.PlanVersions))
+	for _, version := range session.PlanVersions {
+		mockupVersion := 0
+		if version.Mockup != nil {
+			mockupVersion = version.Mockup.Version
+		}
+		out = append(out, map[string]any{
+			"version":        version.Version,
+			"items":          len(version.Plan.Items),
+			"mockup_version": mockupVersion,
+			"feedback":       version.Feedback,
+			"decision":       version.Decision,
+			"created_at":     version.CreatedAt,
+		})
+	}
+	return out
+}
+
+func diffStrings(from, to []string) listDiff {
+	out := listDiff{Added: []string{}, Removed: []string{}}
+	for _, v := range to {
+		if !containsString(from, v) {
+			out.Added = append(out.Added, v)
+		}
+	}
+	for _, v := range from {
+		if !containsString(to, v) {
+			out.Removed = append(out.Removed, v)
+		}
+	}
+	return out
+}
+
+func diffPlanItem(from, to PlanItem) []fieldChange {
+	changes := []fieldChange{}
+	for _, f := range []struct {
+		name     string
+		from, to string
+	}{
+		{"title", from.Title, to.Title},
+		{"owner", from.Owner, to.Owner},
+	} {
+		if f.from != f.to {
+			changes = append(changes, fieldChange{Field: f.name, From: f.from, To: f.to})
+		}
+	}
+	for _, f := range []struct {
+		name     string
+		from, to []string
+	}{
+		{"files", from.Files, to.Files},
+		{"verify", from.Verify, to.Verify},
+		{"requirement_tags", from.RequirementTags, to.RequirementTags},
+		{"criteria", from.Criteria, to.Criteria},
+		{"depends_on", from.DependsOn, to.DependsOn},
+	} {
+		if strings.Join(f.from, "\x00") != strings.Join(f.to, "\x00") {
+			changes = append(changes, fieldChange{Field: f.name, From: f.from, To: f.to})
+		}
+	}
+	return changes
+}
+
+// diffPlans compares plan versions from and to.
+func diffPlans(from, to Plan) planDiff {
+	diff := planDiff{
+		From:        from.Version,
+		To:          to.Version,
+		Items:       planItemsDiff{Added: []PlanItem{}, Removed: []PlanItem{}, Changed: []planItemChange{}},
+		Assumptions: diffStrings(from.Assumptions, to.Assumptions),
+		Risks:       diffStrings(from.Risks, to.Risks),
+	}
+	if from.Title != to.Title {
+		diff.Title = &fieldChange{Field: "title", From: from.Title, To: to.Title}
+	}
+	old := map[string]PlanItem{}
+	for _, item := range from.Items {
+		old[item.ID] = item
+	}
+	seen := map[string]bool{}
+	for _, item := range to.Items {
+		seen[item.ID] = true
+		prev, ok := old[item.ID]
+		if !ok {
+			diff.Items.Added = append(diff.Items.Added, item)
+			continue
+		}
+		if changes := diffPlanItem(prev, item); len(changes) > 0 {
+			diff.Items.Changed = append(diff.Items.Changed, planItemChange{ID: item.ID, Changes: changes})
+		}
+	}
+	for _, item := range from.Items {
+		if !seen[item.ID] {
+			diff.Items.Removed = append(diff.Items.Removed, item)
+		}
+	}
+	return diff
+}
+
+// resolvePlanVersions picks the versions diff_plan compares: by default the
+// latest version against the one before it.
+func resolvePlanVersions(session *SessionState, from, to int) (*PlanVersion, *PlanVersion, error) {
+	n := len(session.PlanVersions)
+	if n == 0 {
+		return nil, nil, fmt.Errorf("session %s has no plan versions yet; call generate_plan first", session.SessionID)
+	}
+	if to <= 0 {
+		to = session.PlanVersions[n-1].Version
+	}
+	if from <= 0 {
+		from = to - 1
+		if from < 1 {
+			from = to
+		}
+	}
+	fromVersion, ok := planVersion(session, from)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown plan version %d; the session has versions 1 to %d", from, session.PlanVersions[n-1].Version)
+	}
+	toVersion, ok := planVersion(session, to)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown plan version %d; the session has versions 1 to %d", to, session.PlanVersions[n-1].Version)
+	}
+	return fromVersion, toVersion, nil
+}
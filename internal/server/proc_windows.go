@@ -0,0 +1,9 @@
+//go:build windows
+
+package server
+
+import "os/exec"
+
+// setProcessGroupKill keeps the default cancellation behavior on Windows,
+// which has no POSIX process groups.
+func setProcessGroupKill(cmd *exec.Cmd) {}
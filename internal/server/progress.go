@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// notifyFunc sends a server-initiated JSON-RPC notification to the client
+// that issued the current request.
+type notifyFunc func(method string, params any)
+
+type contextKey int
+
+const (
+	notifierContextKey contextKey = iota
+	progressContextKey
+	requestScopeContextKey
+	clientNotifierContextKey
+	clientChannelContextKey
+	heldSessionContextKey
+)
+
+func withNotifier(ctx context.Context, notify notifyFunc) context.Context {
+	return context.WithValue(ctx, notifierContextKey, notify)
+}
+
+func notifierFromContext(ctx context.Context) notifyFunc {
+	notify, _ := ctx.Value(notifierContextKey).(notifyFunc)
+	return notify
+}
+
+// withClientNotifier attaches a notifier that outlives the current request,
+// for messages such as resource updates. Transports whose request notifier
+// is already long-lived need not set it.
+func withClientNotifier(ctx context.Context, notify notifyFunc) context.Context {
+	return context.WithValue(ctx, clientNotifierContextKey, notify)
+}
+
+func clientNotifierFromContext(ctx context.Context) notifyFunc {
+	if notify, ok := ctx.Value(clientNotifierContextKey).(notifyFunc); ok {
+		return notify
+	}
+	return notifierFromContext(ctx)
+}
+
+// clientChannel carries server-initiated requests to the client that issued
+// the current request. send reports whether the message could be handed to
+// the transport; gone is closed once the client can no longer answer.
+type clientChannel struct {
+	send func(msg any) bool
+	gone <-chan struct{}
+}
+
+func withClientChannel(ctx context.Context, send func(msg any) bool, gone <-chan struct{}) context.Context {
+	return context.WithValue(ctx, clientChannelContextKey, clientChannel{send: send, gone: gone})
+}
+
+func clientChannelFromContext(ctx context.Context) (clientChannel, bool) {
+	ch, ok := ctx.Value(clientChannelContextKey).(clientChannel)
+	return ch, ok && ch.send != nil
+}
+
+// withRequestScope namespaces request IDs for clients that share the server.
+func withRequestScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, requestScopeContextKey, scope)
+}
+
+func requestScopeFromContext(ctx context.Context) string {
+	scope, _ := ctx.Value(requestScopeContextKey).(string)
+	return scope
+}
+
+// progressReporter emits notifications/progress for one tool call that was
+// issued with a progressToken.
+type progressReporter struct {
+	token  any
+	notify notifyFunc
+	mu     sync.Mutex
+	last   float64
+	sent   bool
+}
+
+// withProgressToken attaches a reporter when the caller asked for progress
+// and the transport can deliver notifications.
+func withProgressToken(ctx context.Context, token any) context.Context {
+	if token == nil {
+		return ctx
+	}
+	notify := notifierFromContext(ctx)
+	if notify == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressContextKey, &progressReporter{token: token, notify: notify})
+}
+
+// progressFromContext returns the reporter for the call, or nil. All
+// reporter methods are safe to call on nil.
+func progressFromContext(ctx context.Context) *progressReporter {
+	p, _ := ctx.Value(progressContextKey).(*progressReporter)
+	return p
+}
+
+func (p *progressReporter) report(progress float64, total int, message string, meta map[string]any) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// The spec requires progress to strictly increase across notifications;
+	// output chunks of one command share its index, so nudge past the last.
+	if p.sent && progress <= p.last {
+		progress = math.Nextafter(p.last, math.Inf(1))
+	}
+	p.last = progress
+	p.sent = true
+	params := map[string]any{
+		"progressToken": p.token,
+		"progress":      progress,
+		"total":         total,
+		"message":       message,
+	}
+	if len(meta) > 0 {
+		params["_meta"] = meta
+	}
+	p.notify("notifications/progress", params)
+}
+
+func (p *progressReporter) commandStarted(index, total int, command string) {
+	p.report(float64(index), total, fmt.Sprintf("[%d/%d] %s", index+1, total, command), map[string]any{
+		"command":       command,
+		"command_index": index + 1,
+		"event":         "started",
+	})
+}
+
+func (p *progressReporter) commandFinished(index, total int, res CommandResult) {
+	p.report(float64(index+1), total, fmt.Sprintf("[%d/%d] %s -> %s (exit %d)", index+1, total, res.Command, res.Status, res.ExitCode), map[string]any{
+		"command":       res.Command,
+		"command_index": index + 1,
+		"event":         "finished",
+		"status":        res.Status,
+		"exit_code":     res.ExitCode,
+	})
+}
+
+// commandOutput returns writers that forward stdout/stderr chunks as
+// progress notifications. Both are nil when no progress was requested.
+func (p *progressReporter) commandOutput(index, total int, command string) (io.Writer, io.Writer) {
+	if p == nil {
+		return nil, nil
+	}
+	return &progressOutputWriter{p: p, index: index, total: total, command: command, stream: "stdout"},
+		&progressOutputWriter{p: p, index: index, total: total, command: command, stream: "stderr"}
+}
+
+type progressOutputWriter struct {
+	p       *progressReporter
+	index   int
+	total   int
+	command string
+	stream  string
+}
+
+func (w *progressOutputWriter) Write(b []byte) (int, error) {
+	w.p.report(float64(w.index), w.total, string(b), map[string]any{
+		"command":       w.command,
+		"command_index": w.index + 1,
+		"event":         "output",
+		"stream":        w.stream,
+	})
+	return len(b), nil
+}
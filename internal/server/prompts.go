@@ -0,0 +1,273 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"codex-mcp/skills"
+)
+
+const (
+	promptResumeSession    = "resume-session"
+	promptCouncilRoleBrief = "council-role-brief"
+)
+
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+type promptDefinition struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []promptArgument `json:"arguments"`
+}
+
+type promptGetRequest struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments"`
+}
+
+// skillPrompt is a SKILL.md file split into its frontmatter and body.
+type skillPrompt struct {
+	name         string
+	description  string
+	argumentHint string
+	body         string
+}
+
+// skillPromptArgument names the single free-form argument of each skill
+// prompt; skills not listed take "input".
+var skillPromptArgument = map[string]string{
+	"troller":        "task",
+	"troller-off":    "reason",
+	"troller-router": "request",
+}
+
+func loadSkillPrompts() ([]skillPrompt, error) {
+	files, err := fs.Glob(skills.FS, "*/SKILL.md")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	out := make([]skillPrompt, 0, len(files))
+	for _, file := range files {
+		raw, err := fs.ReadFile(skills.FS, file)
+		if err != nil {
+			return nil, err
+		}
+		prompt := parseSkillFile(string(raw))
+		if prompt.name == "" {
+			prompt.name = path.Dir(file)
+		}
+		out = append(out, prompt)
+	}
+	return out, nil
+}
+
+func parseSkillFile(raw string) skillPrompt {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	rest, ok := strings.CutPrefix(raw, "---\n")
+	if !ok {
+		return skillPrompt{body: strings.TrimSpace(raw)}
+	}
+	front, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return skillPrompt{body: strings.TrimSpace(raw)}
+	}
+	out := skillPrompt{body: strings.TrimSpace(body)}
+	for _, line := range strings.Split(front, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			out.name = value
+		case "description":
+			out.description = value
+		case "argument-hint":
+			out.argumentHint = value
+		}
+	}
+	return out
+}
+
+func skillArgumentName(name string) string {
+	if arg, ok := skillPromptArgument[name]; ok {
+		return arg
+	}
+	return "input"
+}
+
+func promptListResponse() (map[string]any, error) {
+	skillPrompts, err := loadSkillPrompts()
+	if err != nil {
+		return nil, err
+	}
+	prompts := make([]promptDefinition, 0, len(skillPrompts)+2)
+	for _, prompt := range skillPrompts {
+		prompts = append(prompts, promptDefinition{
+			Name:        prompt.name,
+			Description: prompt.description,
+			Arguments: []promptArgument{
+				{Name: skillArgumentName(prompt.name), Description: prompt.argumentHint},
+			},
+		})
+	}
+	prompts = append(prompts,
+		promptDefinition{
+			Name:        promptResumeSession,
+			Description: "Resume an existing codex-troller session from its current step",
+			Arguments: []promptArgument{
+				{Name: "session_id", Description: "session to resume", Required: true},
+			},
+		},
+		promptDefinition{
+			Name:        promptCouncilRoleBrief,
+			Description: "Briefing instructions for one council manager role",
+			Arguments: []promptArgument{
+				{Name: "session_id", Description: "session in council briefing", Required: true},
+				{Name: "role", Description: "council manager role, e.g. backend_lead", Required: true},
+			},
+		},
+	)
+	return map[string]any{"prompts": prompts}, nil
+}
+
+func (s *MCPServer) getPrompt(req promptGetRequest) (map[string]any, error) {
+	switch req.Name {
+	case promptResumeSession:
+		return s.resumeSessionPrompt(req.Arguments)
+	case promptCouncilRoleBrief:
+		return s.councilRoleBriefPrompt(req.Arguments)
+	}
+	skillPrompts, err := loadSkillPrompts()
+	if err != nil {
+		return nil, err
+	}
+	for _, prompt := range skillPrompts {
+		if prompt.name != req.Name {
+			continue
+		}
+		text := prompt.body
+		if value := strings.TrimSpace(req.Arguments[skillArgumentName(prompt.name)]); value != "" {
+			text += fmt.Sprintf("\n\n## User Input\n\n%s", value)
+		}
+		return promptResult(prompt.description, text), nil
+	}
+	return nil, fmt.Errorf("unknown prompt: %s", req.Name)
+}
+
+func (s *MCPServer) resumeSessionPrompt(args map[string]string) (map[string]any, error) {
+	session, err := s.promptSession(args)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Resume codex-troller session %s.\n\n", session.SessionID)
+	fmt.Fprintf(&b, "- Current step: %s\n", session.Step)
+	fmt.Fprintf(&b, "- Next action: %s\n", nextAction(session))
+	if goal := strings.TrimSpace(session.Intent.Goal); goal != "" {
+		fmt.Fprintf(&b, "- Goal: %s\n", goal)
+	}
+	if session.LastError != "" {
+		fmt.Fprintf(&b, "- Last error: %s\n", session.LastError)
+	}
+	fmt.Fprintf(&b, "\nCall `reconcile_session_state` with `session_id=%q` and `mode=\"check\"` first. If drift is high, ask the user to choose `keep_context` or `restart_context`. Then call `get_session_status` before each workflow tool and follow `next`.\n", session.SessionID)
+	skillPrompts, err := loadSkillPrompts()
+	if err != nil {
+		return nil, err
+	}
+	for _, prompt := range skillPrompts {
+		if prompt.name == "troller" {
+			fmt.Fprintf(&b, "\n## Workflow Reference\n\n%s\n", prompt.body)
+		}
+	}
+	return promptResult("Resume session "+session.SessionID, b.String()), nil
+}
+
+func (s *MCPServer) councilRoleBriefPrompt(args map[string]string) (map[string]any, error) {
+	session, err := s.promptSession(args)
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(args["role"])
+	if role == "" {
+		return nil, fmt.Errorf("missing required argument: role")
+	}
+	var manager *CouncilManager
+	roles := make([]string, 0, len(session.CouncilManagers))
+	for i := range session.CouncilManagers {
+		roles = append(roles, session.CouncilManagers[i].Role)
+		if session.CouncilManagers[i].Role == role {
+			manager = &session.CouncilManagers[i]
+		}
+	}
+	if manager == nil {
+		return nil, fmt.Errorf("unknown council role %q; session roles: %s", role, strings.Join(roles, ", "))
+	}
+
+	var b strings.Builder
+	b.WriteString(councilBriefPrompt(session, role))
+	fmt.Fprintf(&b, "\nDomain: %s\n", manager.Domain)
+	if len(session.Intent.Scope) > 0 {
+		fmt.Fprintf(&b, "Scope: %s\n", strings.Join(session.Intent.Scope, "; "))
+	}
+	if len(session.Intent.Constraints) > 0 {
+		fmt.Fprintf(&b, "Constraints: %s\n", strings.Join(session.Intent.Constraints, "; "))
+	}
+	if len(session.Intent.SuccessCriteria) > 0 {
+		fmt.Fprintf(&b, "Success criteria: %s\n", strings.Join(session.Intent.SuccessCriteria, "; "))
+	}
+	if s.council != nil {
+		if topics, err := s.council.loadTopics(session.SessionID); err == nil && len(topics) > 0 {
+			b.WriteString("Current agenda:\n")
+			for _, topic := range topics {
+				fmt.Fprintf(&b, "- [%d] %s (%s)\n", topic.ID, topic.Title, topic.Status)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "\nWork independently of the other roles, then call `council_submit_brief` with `session_id=%q`, `role=%q`, `priority`, `contribution`, `quick_decisions` and `topic_proposals`.\n", session.SessionID, role)
+	return promptResult(fmt.Sprintf("Council brief for %s", role), b.String()), nil
+}
+
+// promptSession resolves the session_id argument to a snapshot of an
+// existing session; prompts never create sessions.
+func (s *MCPServer) promptSession(args map[string]string) (*SessionState, error) {
+	id := strings.TrimSpace(args["session_id"])
+	if id == "" {
+		return nil, fmt.Errorf("missing required argument: session_id")
+	}
+	raw, ok := s.sessionSnapshot(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown session: %s", id)
+	}
+	var session SessionState
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	ensureCouncilManagerDefaults(&session)
+	return &session, nil
+}
+
+func promptResult(description, text string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"messages": []any{
+			map[string]any{
+				"role": "user",
+				"content": map[string]any{
+					"type": "text",
+					"text": text,
+				},
+			},
+		},
+	}
+}
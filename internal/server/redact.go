@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// redactedText replaces every secret found in command output.
+const redactedText = "[REDACTED]"
+
+// secretDetector finds secrets with a regular expression. When the
+// expression has a group named "secret" only that group is replaced, so
+// labels such as "Authorization: Bearer" stay readable.
+type secretDetector struct {
+	name string
+	re   *regexp.Regexp
+}
+
+func newSecretDetector(name, pattern string) (secretDetector, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return secretDetector{}, err
+	}
+	return secretDetector{name: name, re: re}, nil
+}
+
+func mustSecretDetector(name, pattern string) secretDetector {
+	d, err := newSecretDetector(name, pattern)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// builtinSecretDetectors cover token formats seen in npm, git and cloud
+// CLI output.
+var builtinSecretDetectors = []secretDetector{
+	mustSecretDetector("private_key", `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	mustSecretDetector("github_token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	mustSecretDetector("npm_token", `\bnpm_[A-Za-z0-9]{36}\b`),
+	mustSecretDetector("npmrc_auth", `(?i)(?:_authToken|_auth|_password)\s*=\s*(?P<secret>[^\s"']+)`),
+	mustSecretDetector("aws_access_key", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	mustSecretDetector("google_api_key", `\bAIza[0-9A-Za-z_-]{35}\b`),
+	mustSecretDetector("slack_token", `\bxox[abposr]-[A-Za-z0-9-]{10,}`),
+	mustSecretDetector("stripe_key", `\b(?:sk|rk|pk)_(?:live|test)_[A-Za-z0-9]{16,}\b`),
+	mustSecretDetector("api_key", `\bsk-[A-Za-z0-9_-]{20,}`),
+	mustSecretDetector("jwt", `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	mustSecretDetector("bearer", `(?i)\b(?:bearer|token)\s+(?P<secret>[A-Za-z0-9._~+/-]{16,}=*)`),
+	mustSecretDetector("url_credentials", `(?i)\b[a-z][a-z0-9+.-]*://(?P<secret>[^/\s:@]*(?::[^/\s@]*)?)@`),
+	mustSecretDetector("secret_assignment", `(?i)\b[A-Z0-9_]*(?:TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIALS?)[A-Z0-9_]*\s*[=:]\s*(?P<secret>"[^"\n]+"|'[^'\n]+'|[^\s"']+)`),
+}
+
+// secretEnvName matches environment variable names whose values are
+// treated as secrets. AUTH counts only as the last word of the name, so
+// SSH_AUTH_SOCK and XAUTHORITY, which hold paths, do not match.
+var secretEnvName = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIAL|(?:^|_)AUTH$)`)
+
+// inlineAssignment matches NAME=value prefixes in a shell command.
+var inlineAssignment = regexp.MustCompile(`(?:^|\s)([A-Za-z_][A-Za-z0-9_]*)=("[^"]*"|'[^']*'|\S+)`)
+
+// entropyCandidate matches token-like words checked for randomness.
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`)
+
+const (
+	// minSecretValueLen keeps short env values such as "1" from being
+	// redacted everywhere they appear.
+	minSecretValueLen = 6
+	// minEntropyBits is the Shannon entropy per character above which a
+	// mixed-case alphanumeric token is taken for a secret. Hex digests stay
+	// below it.
+	minEntropyBits = 4.2
+	// maxPendingOutput bounds how much of an unfinished output line is held
+	// back from progress notifications.
+	maxPendingOutput = 4096
+)
+
+// redactor removes secrets from command output before it is stored or
+// returned.
+type redactor struct {
+	detectors []secretDetector
+	// literals are secret values passed in through the environment.
+	literals []string
+}
+
+// newRedactor builds a redactor from the built-in detectors, the secret
+// values in environ and user patterns. Invalid patterns are returned as an
+// error after the valid ones are added.
+func newRedactor(patterns []string, environ []string) (*redactor, error) {
+	r := &redactor{detectors: append([]secretDetector{}, builtinSecretDetectors...)}
+	var bad []string
+	for i, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		d, err := newSecretDetector(fmt.Sprintf("custom_%d", i+1), pattern)
+		if err != nil {
+			bad = append(bad, fmt.Sprintf("%q: %v", pattern, err))
+			continue
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && secretEnvName.MatchString(name) {
+			r.literals = appendSecretLiteral(r.literals, value)
+		}
+	}
+	if len(bad) > 0 {
+		return r, fmt.Errorf("invalid redaction patterns: %s", strings.Join(bad, "; "))
+	}
+	return r, nil
+}
+
+func appendSecretLiteral(literals []string, value string) []string {
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+	if len(value) < minSecretValueLen {
+		return literals
+	}
+	for _, existing := range literals {
+		if existing == value {
+			return literals
+		}
+	}
+	return append(literals, value)
+}
+
+// forCommand returns a redactor that also hides the secret values a
+// command sets inline, as in `NPM_TOKEN=... npm publish`.
+func (r *redactor) forCommand(command string) *redactor {
+	if r == nil {
+		return nil
+	}
+	literals := r.literals
+	for _, m := range inlineAssignment.FindAllStringSubmatch(command, -1) {
+		if secretEnvName.MatchString(m[1]) {
+			literals = appendSecretLiteral(literals, m[2])
+		}
+	}
+	if len(literals) == len(r.literals) {
+		return r
+	}
+	return &redactor{detectors: r.detectors, literals: literals}
+}
+
+type secretSpan struct{ start, end int }
+
+// redact replaces the secrets in text and reports how many it replaced.
+func (r *redactor) redact(text string) (string, int) {
+	if r == nil || text == "" {
+		return text, 0
+	}
+	spans := []secretSpan{}
+	for _, d := range r.detectors {
+		group := d.re.SubexpIndex("secret")
+		for _, m := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if group > 0 {
+				start, end = m[2*group], m[2*group+1]
+			}
+			if start >= 0 && end > start {
+				spans = append(spans, secretSpan{start, end})
+			}
+		}
+	}
+	for _, literal := range r.literals {
+		for offset := 0; ; {
+			i := strings.Index(text[offset:], literal)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			spans = append(spans, secretSpan{start, start + len(literal)})
+			offset = start + len(literal)
+		}
+	}
+	for _, m := range entropyCandidate.FindAllStringIndex(text, -1) {
+		if looksRandom(text[m[0]:m[1]]) {
+			spans = append(spans, secretSpan{m[0], m[1]})
+		}
+	}
+	if len(spans) == 0 {
+		return text, 0
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var b strings.Builder
+	count, last := 0, 0
+	for i := 0; i < len(spans); {
+		span := spans[i]
+		for i++; i < len(spans) && spans[i].start < span.end; i++ {
+			span.end = max(span.end, spans[i].end)
+		}
+		b.WriteString(text[last:span.start])
+		b.WriteString(redactedText)
+		last = span.end
+		count++
+	}
+	b.WriteString(text[last:])
+	return b.String(), count
+}
+
+// looksRandom reports whether a token mixes upper case, lower case and
+// digits with high per-character entropy, as generated keys do.
+func looksRandom(token string) bool {
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, c := range token {
+		counts[c]++
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(token))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minEntropyBits
+}
+
+// redactResult redacts every text field of a command result and records
+// the number of redactions.
+func (r *redactor) redactResult(res CommandResult) CommandResult {
+	r = r.forCommand(res.Command)
+	var n, total int
+	res.Command, n = r.redact(res.Command)
+	total += n
+	res.Stdout, n = r.redact(res.Stdout)
+	total += n
+	res.Stderr, n = r.redact(res.Stderr)
+	total += n
+	res.Error, n = r.redact(res.Error)
+	total += n
+	res.Redactions = total
+	return res
+}
+
+// stream wraps a progress writer so streamed output is redacted a line at
+// a time. It returns nil for a nil writer. Call flush when output ends.
+func (r *redactor) stream(w io.Writer) *redactingWriter {
+	if w == nil {
+		return nil
+	}
+	return &redactingWriter{r: r, w: w}
+}
+
+// redactingWriter holds back partial lines so a secret split across
+// writes is still matched.
+type redactingWriter struct {
+	r       *redactor
+	w       io.Writer
+	pending []byte
+}
+
+func (w *redactingWriter) Write(b []byte) (int, error) {
+	w.pending = append(w.pending, b...)
+	if i := bytes.LastIndexByte(w.pending, '\n'); i >= 0 {
+		w.emit(i + 1)
+	} else if len(w.pending) > maxPendingOutput {
+		w.emit(len(w.pending))
+	}
+	return len(b), nil
+}
+
+func (w *redactingWriter) emit(n int) {
+	out, _ := w.r.redact(string(w.pending[:n]))
+	w.pending = w.pending[n:]
+	_, _ = io.WriteString(w.w, out)
+}
+
+func (w *redactingWriter) flush() {
+	if w != nil && len(w.pending) > 0 {
+		w.emit(len(w.pending))
+	}
+}
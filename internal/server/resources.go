@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	resourceScheme = "troller://"
+	// councilResourceMessageLimit caps the transcript returned by the
+	// council messages resource to its most recent entries.
+	councilResourceMessageLimit = 200
+)
+
+// errResourceNotFound maps to the MCP resource-not-found error code.
+var errResourceNotFound = errors.New("resource not found")
+
+type resourceRef struct {
+	kind      string // session, plan, council_messages, council_topics
+	sessionID string
+}
+
+type resourceReadRequest struct {
+	URI string `json:"uri"`
+}
+
+// resourceSubscription tracks the clients watching one URI and the content
+// they last saw, so updates are sent only on real changes.
+type resourceSubscription struct {
+	lastContent string
+	subscribers map[string]notifyFunc
+}
+
+func resourceError(uri string, err error) *rpcError {
+	if errors.Is(err, errResourceNotFound) {
+		return &rpcError{Code: -32002, Message: fmt.Sprintf("resource not found: %s", uri)}
+	}
+	return &rpcError{Code: -32602, Message: err.Error()}
+}
+
+func parseResourceURI(uri string) (resourceRef, error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok {
+		return resourceRef{}, fmt.Errorf("unsupported resource uri: %s", uri)
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+		return resourceRef{}, fmt.Errorf("unsupported resource uri: %s", uri)
+	}
+	id := parts[1]
+	switch {
+	case parts[0] == "session" && len(parts) == 2:
+		return resourceRef{kind: "session", sessionID: id}, nil
+	case parts[0] == "session" && len(parts) == 3 && parts[2] == "plan":
+		return resourceRef{kind: "plan", sessionID: id}, nil
+	case parts[0] == "council" && len(parts) == 3 && parts[2] == "messages":
+		return resourceRef{kind: "council_messages", sessionID: id}, nil
+	case parts[0] == "council" && len(parts) == 3 && parts[2] == "topics":
+		return resourceRef{kind: "council_topics", sessionID: id}, nil
+	default:
+		return resourceRef{}, fmt.Errorf("unsupported resource uri: %s", uri)
+	}
+}
+
+func resourceTemplatesResponse() map[string]any {
+	return map[string]any{
+		"resourceTemplates": []map[string]any{
+			{"uriTemplate": "troller://session/{id}", "name": "session", "description": "Full workflow session state", "mimeType": "application/json"},
+			{"uriTemplate": "troller://session/{id}/plan", "name": "session-plan", "description": "Plan, mockup and approval status of a session", "mimeType": "application/json"},
+			{"uriTemplate": "troller://council/{id}/messages", "name": "council-messages", "description": "Recent council transcript of a session", "mimeType": "application/json"},
+			{"uriTemplate": "troller://council/{id}/topics", "name": "council-topics", "description": "Council topics and their status", "mimeType": "application/json"},
+		},
+	}
+}
+
+func (s *MCPServer) resourceListResponse() map[string]any {
+	s.mu.Lock()
+	sessions := make([]*SessionState, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.SessionID)
+	}
+	sort.Strings(ids)
+
+	resources := []map[string]any{}
+	for _, id := range ids {
+		resources = append(resources,
+			map[string]any{"uri": resourceScheme + "session/" + id, "name": "session " + id, "mimeType": "application/json"},
+			map[string]any{"uri": resourceScheme + "session/" + id + "/plan", "name": "plan " + id, "mimeType": "application/json"},
+		)
+		if s.council != nil {
+			resources = append(resources,
+				map[string]any{"uri": resourceScheme + "council/" + id + "/messages", "name": "council messages " + id, "mimeType": "application/json"},
+				map[string]any{"uri": resourceScheme + "council/" + id + "/topics", "name": "council topics " + id, "mimeType": "application/json"},
+			)
+		}
+	}
+	return map[string]any{"resources": resources}
+}
+
+// readResource renders the JSON content behind a troller:// URI.
+func (s *MCPServer) readResource(uri string) (string, error) {
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return "", err
+	}
+	switch ref.kind {
+	case "session", "plan":
+		raw, ok := s.sessionSnapshot(ref.sessionID)
+		if !ok {
+			return "", errResourceNotFound
+		}
+		if ref.kind == "session" {
+			return string(raw), nil
+		}
+		var session SessionState
+		if err := json.Unmarshal(raw, &session); err != nil {
+			return "", err
+		}
+		return mustJSON(map[string]any{
+			"session_id":    session.SessionID,
+			"step":          session.Step,
+			"plan_approved": session.PlanApproved,
+			"plan":          session.Plan,
+			"mockup":        session.Mockup,
+		}), nil
+	default:
+		if s.council == nil {
+			return "", fmt.Errorf("council store is not available")
+		}
+		if !s.hasSession(ref.sessionID) {
+			return "", errResourceNotFound
+		}
+		if ref.kind == "council_messages" {
+			messages, err := s.council.loadMessages(ref.sessionID, councilResourceMessageLimit)
+			if err != nil {
+				return "", err
+			}
+			return mustJSON(map[string]any{"session_id": ref.sessionID, "messages": messages}), nil
+		}
+		topics, err := s.council.loadTopics(ref.sessionID)
+		if err != nil {
+			return "", err
+		}
+		return mustJSON(map[string]any{"session_id": ref.sessionID, "topics": topics}), nil
+	}
+}
+
+func (s *MCPServer) hasSession(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[id]
+	return ok
+}
+
+// sessionSnapshot encodes a session without waiting on a long tool call:
+// when the session is busy, its stored copy is served.
+func (s *MCPServer) sessionSnapshot(id string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	lock := s.sessionLock(id)
+	if !lock.TryLock() {
+		if session, ok = s.storedCopy(id); !ok {
+			return nil, false
+		}
+	} else {
+		defer lock.Unlock()
+	}
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+func (s *MCPServer) subscribeResource(ctx context.Context, uri string) error {
+	if _, err := parseResourceURI(uri); err != nil {
+		return err
+	}
+	notify := clientNotifierFromContext(ctx)
+	if notify == nil {
+		return fmt.Errorf("transport cannot deliver notifications")
+	}
+	content, err := s.readResource(uri)
+	if err != nil && !errors.Is(err, errResourceNotFound) {
+		return err
+	}
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	sub, ok := s.subscriptions[uri]
+	if !ok {
+		sub = &resourceSubscription{lastContent: content, subscribers: map[string]notifyFunc{}}
+		s.subscriptions[uri] = sub
+	}
+	sub.subscribers[requestScopeFromContext(ctx)] = notify
+	return nil
+}
+
+func (s *MCPServer) unsubscribeResource(ctx context.Context, uri string) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	sub, ok := s.subscriptions[uri]
+	if !ok {
+		return
+	}
+	delete(sub.subscribers, requestScopeFromContext(ctx))
+	if len(sub.subscribers) == 0 {
+		delete(s.subscriptions, uri)
+	}
+}
+
+// dropSubscriptions forgets every subscription of a departed client.
+func (s *MCPServer) dropSubscriptions(scope string) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for uri, sub := range s.subscriptions {
+		delete(sub.subscribers, scope)
+		if len(sub.subscribers) == 0 {
+			delete(s.subscriptions, uri)
+		}
+	}
+}
+
+// publishResourceUpdates re-reads every subscribed resource and sends
+// notifications/resources/updated for those whose content changed.
+func (s *MCPServer) publishResourceUpdates() {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for uri, sub := range s.subscriptions {
+		content, err := s.readResource(uri)
+		if err != nil || content == sub.lastContent {
+			continue
+		}
+		sub.lastContent = content
+		for _, notify := range sub.subscribers {
+			notify("notifications/resources/updated", map[string]any{"uri": uri})
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,17 +12,32 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"log/slog"
 )
 
 type Config struct {
-	WorkDir          string
-	AllowedCommands  []string
-	Logger           *slog.Logger
+	WorkDir         string
+	AllowedCommands []string
+	Logger          *slog.Logger
+	// StatePath is the legacy sessions.json location. Sessions now live in
+	// DiscussionDBPath; a file found here is imported once on startup.
 	StatePath        string
 	DiscussionDBPath string
 	DefaultProfile   string
+	// Version is reported as serverInfo.version; set at build time.
+	Version string
+	// StrictSessionIDs makes tool calls naming an unknown session_id fail
+	// instead of creating an empty session under that ID. Calls without a
+	// session_id still start a new session.
+	StrictSessionIDs bool
+	// Retention selects the sessions PruneSessions archives.
+	Retention RetentionPolicy
+	// RedactPatterns are extra regular expressions for secrets to remove
+	// from command output, on top of the built-in detectors. A group named
+	// "secret" limits the replacement to that group.
+	RedactPatterns []string
 }
 
 type MCPServer struct {
@@ -34,40 +50,92 @@ type MCPServer struct {
 	hasDefaultProfile  bool
 	autostartMode      string
 	autostartSessionID string
+	// sessionLocks serializes tool calls per session so concurrent requests
+	// never mutate the same SessionState at once.
+	sessionLocks map[string]*sync.Mutex
+	writeMu      sync.Mutex
+	persistMu    sync.Mutex
+	// touched marks the sessions tool calls used since they were last
+	// written, so a write encodes only those. Guarded by mu.
+	touched map[string]bool
+	// inflight holds cancel funcs of running requests keyed by JSON-encoded ID.
+	inflight map[string]context.CancelFunc
+	// subscriptions maps resource URIs to the clients watching them.
+	subsMu        sync.Mutex
+	subscriptions map[string]*resourceSubscription
+	// store persists sessions in the council database.
+	store *sessionStore
+	// stateErr is why the state could not be opened or loaded, if it
+	// could not.
+	stateErr error
+	// lastBackup is when the database was last backed up; guarded by
+	// persistMu.
+	lastBackup time.Time
+	// clients holds negotiated protocol state per request scope.
+	clients map[string]*clientState
+	// clientCalls holds server-initiated requests awaiting a client
+	// response, keyed like inflight.
+	clientCalls   map[string]chan jsonRPCRequest
+	clientCallSeq uint64
+	// redactor removes secrets from command results before they are
+	// stored or returned.
+	redactor *redactor
+}
+
+// withStateDefaults fills in the logger and the state file locations.
+func withStateDefaults(cfg Config) Config {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	if cfg.StatePath == "" {
+		cfg.StatePath = filepath.Join(".codex-mcp", "state", "sessions.json")
+	}
+	if cfg.DiscussionDBPath == "" {
+		cfg.DiscussionDBPath = filepath.Join(filepath.Dir(cfg.StatePath), "council.db")
+	}
+	if cfg.DefaultProfile == "" {
+		cfg.DefaultProfile = filepath.Join(filepath.Dir(cfg.StatePath), "default_user_profile.json")
+	}
+	return cfg
 }
 
 func NewMCPServer(cfg Config) *MCPServer {
+	cfg = withStateDefaults(cfg)
 	logger := cfg.Logger
-	if logger == nil {
-		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
-	}
 	if cfg.AllowedCommands == nil || len(cfg.AllowedCommands) == 0 {
 		cfg.AllowedCommands = []string{"go", "git", "npm", "make", "echo"}
 	}
 	srv := &MCPServer{
-		cfg:      cfg,
-		sessions: map[string]*SessionState{},
-		logger:   logger,
+		cfg:           cfg,
+		sessions:      map[string]*SessionState{},
+		sessionLocks:  map[string]*sync.Mutex{},
+		touched:       map[string]bool{},
+		inflight:      map[string]context.CancelFunc{},
+		subscriptions: map[string]*resourceSubscription{},
+		clients:       map[string]*clientState{},
+		clientCalls:   map[string]chan jsonRPCRequest{},
+		logger:        logger,
 		// Session-scoped skill mode: reset to off when MCP process restarts.
 		autostartMode: "off",
 	}
+	if srv.cfg.Version == "" {
+		srv.cfg.Version = "dev"
+	}
 	if srv.cfg.WorkDir == "" {
 		srv.cfg.WorkDir = "."
 	}
-	if srv.cfg.StatePath == "" {
-		srv.cfg.StatePath = filepath.Join(".codex-mcp", "state", "sessions.json")
-	}
-	if srv.cfg.DiscussionDBPath == "" {
-		srv.cfg.DiscussionDBPath = filepath.Join(filepath.Dir(srv.cfg.StatePath), "council.db")
-	}
-	if srv.cfg.DefaultProfile == "" {
-		srv.cfg.DefaultProfile = filepath.Join(filepath.Dir(srv.cfg.StatePath), "default_user_profile.json")
+	redactor, err := newRedactor(srv.cfg.RedactPatterns, os.Environ())
+	if err != nil {
+		srv.logger.Error("ignoring redaction patterns", "error", err)
 	}
-	store, err := newCouncilStore(srv.cfg.DiscussionDBPath)
+	srv.redactor = redactor
+	council, store, err := openStateStores(srv.cfg.DiscussionDBPath, srv.logger)
 	if err != nil {
-		srv.logger.Error("failed to initialize council store", "error", err)
+		srv.stateErr = err
+		srv.logger.Error("failed to initialize state store", "error", err)
 	} else {
-		srv.council = store
+		srv.council = council
+		srv.store = store
 	}
 	if profile, ok, err := loadDefaultUserProfile(srv.cfg.DefaultProfile); err != nil {
 		srv.logger.Warn("failed to load default user profile", "path", srv.cfg.DefaultProfile, "error", err)
@@ -75,15 +143,34 @@ func NewMCPServer(cfg Config) *MCPServer {
 		srv.defaultUserProfile = profile
 		srv.hasDefaultProfile = true
 	}
-	_ = srv.loadSessions()
+	if err := srv.loadSessions(); err != nil && srv.stateErr == nil {
+		srv.stateErr = err
+		srv.logger.Error("failed to load sessions", "error", err)
+	}
 	return srv
 }
 
+// StateError reports why persisted state could not be opened or loaded.
+// The server still runs without it; callers refuse to start on
+// ErrSchemaTooNew so a newer database is never written by an older binary.
+func (s *MCPServer) StateError() error {
+	return s.stateErr
+}
+
+// jsonRPCRequest is any message read from the client. Besides requests and
+// notifications it may be a response to a server-initiated request, in
+// which case Method is empty and Result or Error is set.
 type jsonRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      any             `json:"id"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func (r jsonRPCRequest) isResponse() bool {
+	return r.Method == "" && r.ID != nil && (r.Result != nil || r.Error != nil)
 }
 
 type jsonRPCResponse struct {
@@ -96,17 +183,77 @@ type jsonRPCResponse struct {
 type rpcError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// toolCallError maps a tools/call protocol failure to its JSON-RPC error.
+// Bad arguments and unknown tools are invalid params. Tool-level failures
+// are not errors here; they come back as isError results.
+func toolCallError(err error) *rpcError {
+	var argErr *toolArgumentError
+	switch {
+	case errors.As(err, &argErr):
+		return &rpcError{Code: -32602, Message: err.Error(), Data: map[string]any{"field": argErr.Field}}
+	case errors.Is(err, errUnknownTool):
+		return &rpcError{Code: -32602, Message: err.Error()}
+	default:
+		return &rpcError{Code: -32000, Message: err.Error()}
+	}
+}
+
+func toolCallResult(content any, isError bool) map[string]any {
+	result := map[string]any{
+		"content": []any{
+			map[string]any{
+				"type": "text",
+				"text": mustJSON(content),
+			},
+		},
+		"structuredContent": content,
+	}
+	if isError {
+		result["isError"] = true
+	}
+	return result
+}
+
+type jsonRPCNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
 }
 
 type toolCallRequest struct {
 	Name      string          `json:"name"`
 	Arguments json.RawMessage `json:"arguments"`
+	Meta      struct {
+		ProgressToken any `json:"progressToken"`
+	} `json:"_meta"`
+}
+
+type cancelledNotification struct {
+	RequestID any    `json:"requestId"`
+	Reason    string `json:"reason"`
 }
 
 func (s *MCPServer) Run(ctx context.Context) error {
-	reader := bufio.NewReader(os.Stdin)
-	writer := bufio.NewWriter(os.Stdout)
+	return s.serveStream(ctx, os.Stdin, os.Stdout)
+}
+
+// serveStream reads requests sequentially and dispatches each one on its own
+// goroutine, so a long-running tool call does not block unrelated requests.
+// Responses are written as they complete; pending calls are drained on EOF.
+func (s *MCPServer) serveStream(ctx context.Context, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	writer := bufio.NewWriter(out)
 	defer writer.Flush()
+	var inflight sync.WaitGroup
+	// gone is closed when input ends so calls waiting on the client give up
+	// before the pending ones are drained.
+	gone := make(chan struct{})
+	defer s.forgetClient("")
+	defer inflight.Wait()
+	defer close(gone)
 	mode := wireModeAuto
 
 	for {
@@ -123,30 +270,55 @@ func (s *MCPServer) Run(ctx context.Context) error {
 				continue
 			}
 			mode = nextMode
-
-			resp := s.handle(req)
-			if req.ID == nil {
-				// JSON-RPC notification: do not reply.
+			if req.isResponse() {
+				s.deliverClientResponse(ctx, req)
 				continue
 			}
-			s.send(writer, resp, mode)
+
+			// Register before dispatch so a cancellation read right after
+			// this request always finds it.
+			reqCtx, finish := s.trackRequest(ctx, req.ID)
+			inflight.Add(1)
+			go func(req jsonRPCRequest, mode wireMode) {
+				defer inflight.Done()
+				sendMsg := func(msg any) bool { return s.send(writer, msg, mode) }
+				resp, ok := s.runTracked(withClientChannel(reqCtx, sendMsg, gone), finish, req, func(method string, params any) {
+					sendMsg(jsonRPCNotification{JSONRPC: "2.0", Method: method, Params: params})
+				})
+				if ok {
+					s.send(writer, resp, mode)
+				}
+			}(req, mode)
 		}
 	}
 }
 
-func (s *MCPServer) send(w *bufio.Writer, resp jsonRPCResponse, mode wireMode) {
-	bytes, err := json.Marshal(resp)
+// runTracked handles a request registered with trackRequest and reports
+// whether a reply is due. Notifications and cancelled requests get none.
+func (s *MCPServer) runTracked(reqCtx context.Context, finish func(), req jsonRPCRequest, notify notifyFunc) (jsonRPCResponse, bool) {
+	resp := s.handleContext(withNotifier(reqCtx, notify), req)
+	cancelled := reqCtx.Err() != nil
+	finish()
+	return resp, req.ID != nil && !cancelled
+}
+
+// send writes one JSON-RPC message (response or notification) and reports
+// whether it was written.
+func (s *MCPServer) send(w *bufio.Writer, msg any, mode wireMode) bool {
+	bytes, err := json.Marshal(msg)
 	if err != nil {
-		s.logger.Error("response marshal failed", "error", err)
-		return
+		s.logger.Error("message marshal failed", "error", err)
+		return false
 	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 	if mode == wireModeContentLength {
 		_, _ = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(bytes))
 		_, _ = w.Write(bytes)
 	} else {
 		_, _ = w.Write(append(bytes, '\n'))
 	}
-	_ = w.Flush()
+	return w.Flush() == nil
 }
 
 type wireMode int
@@ -264,23 +436,65 @@ func readContentLengthRequest(reader *bufio.Reader) (jsonRPCRequest, error) {
 	return req, nil
 }
 
+// requestKey identifies an in-flight request. IDs are only unique per
+// client, so HTTP clients prefix them with their transport session.
+func requestKey(ctx context.Context, id any) string {
+	if scope := requestScopeFromContext(ctx); scope != "" {
+		return scope + "/" + mustJSON(id)
+	}
+	return mustJSON(id)
+}
+
+// trackRequest derives a cancellable context for a request so that a later
+// notifications/cancelled can abort it. finish must be called once the
+// request completes.
+func (s *MCPServer) trackRequest(ctx context.Context, id any) (context.Context, func()) {
+	reqCtx, cancel := context.WithCancel(ctx)
+	if id == nil {
+		return reqCtx, cancel
+	}
+	key := requestKey(ctx, id)
+	s.mu.Lock()
+	s.inflight[key] = cancel
+	s.mu.Unlock()
+	return reqCtx, func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+func (s *MCPServer) cancelRequest(ctx context.Context, id any, reason string) bool {
+	key := requestKey(ctx, id)
+	s.mu.Lock()
+	cancel, ok := s.inflight[key]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	s.logger.Info("request cancelled by client", "request_id", key, "reason", reason)
+	cancel()
+	return true
+}
+
 func (s *MCPServer) handle(req jsonRPCRequest) jsonRPCResponse {
+	return s.handleContext(context.Background(), req)
+}
+
+func (s *MCPServer) handleContext(ctx context.Context, req jsonRPCRequest) jsonRPCResponse {
 	if req.JSONRPC != "" && req.JSONRPC != "2.0" {
 		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32600, Message: "invalid jsonrpc version"}}
 	}
 
 	switch req.Method {
 	case "initialize":
-		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{
-			"protocolVersion": "2024-11-05",
-			"capabilities": map[string]any{
-				"tools": map[string]any{},
-			},
-			"serverInfo": map[string]any{
-				"name":    "codex-mcp-local",
-				"version": "0.1.0",
-			},
-		}}
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: s.initialize(ctx, req.Params)}
+	case "notifications/initialized":
+		s.markClientInitialized(ctx)
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
+	case "ping":
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
 	case "tools/list":
 		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: toolListResponse()}
 	case "tools/call":
@@ -288,20 +502,76 @@ func (s *MCPServer) handle(req jsonRPCRequest) jsonRPCResponse {
 		if err := json.Unmarshal(req.Params, &callReq); err != nil {
 			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}}
 		}
-		result, err := s.handleTool(callReq)
-		if err != nil {
-			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32000, Message: err.Error()}}
+		ctx = withProgressToken(ctx, callReq.Meta.ProgressToken)
+		result, err := s.handleTool(ctx, callReq)
+		var failure *toolFailure
+		if err != nil && !errors.As(err, &failure) {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: toolCallError(err)}
 		}
 		_ = s.persistSessions()
+		s.publishResourceUpdates()
+		if failure != nil {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: toolCallResult(failure, true)}
+		}
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: toolCallResult(result, false)}
+	case "resources/list":
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: s.resourceListResponse()}
+	case "resources/templates/list":
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: resourceTemplatesResponse()}
+	case "resources/read":
+		var params resourceReadRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil || strings.TrimSpace(params.URI) == "" {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}}
+		}
+		content, err := s.readResource(params.URI)
+		if err != nil {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: resourceError(params.URI, err)}
+		}
 		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{
-			"content": []any{
+			"contents": []any{
 				map[string]any{
-					"type": "text",
-					"text": mustJSON(result),
+					"uri":      params.URI,
+					"mimeType": "application/json",
+					"text":     content,
 				},
 			},
-			"structuredContent": result,
 		}}
+	case "resources/subscribe", "resources/unsubscribe":
+		var params resourceReadRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil || strings.TrimSpace(params.URI) == "" {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}}
+		}
+		if req.Method == "resources/unsubscribe" {
+			s.unsubscribeResource(ctx, params.URI)
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
+		}
+		if err := s.subscribeResource(ctx, params.URI); err != nil {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: resourceError(params.URI, err)}
+		}
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
+	case "prompts/list":
+		result, err := promptListResponse()
+		if err != nil {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32603, Message: err.Error()}}
+		}
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+	case "prompts/get":
+		var params promptGetRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil || strings.TrimSpace(params.Name) == "" {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}}
+		}
+		result, err := s.getPrompt(params)
+		if err != nil {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: err.Error()}}
+		}
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+	case "notifications/cancelled":
+		var params cancelledNotification
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID == nil {
+			return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32602, Message: "invalid params"}}
+		}
+		s.cancelRequest(ctx, params.RequestID, params.Reason)
+		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
 	default:
 		return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32601, Message: fmt.Sprintf("method not found: %s", req.Method)}}
 	}
@@ -314,23 +584,12 @@ func (s *MCPServer) getOrCreateSession(id string) *SessionState {
 	if id == "" {
 		session := NewSession()
 		s.sessions[session.SessionID] = session
+		s.touched[session.SessionID] = true
 		return session
 	}
 
+	s.touched[id] = true
 	if session, ok := s.sessions[id]; ok {
-		if len(session.StepHistory) == 0 {
-			session.StepHistory = []WorkStep{session.Step}
-		}
-		if session.MaxFixLoops <= 0 {
-			session.MaxFixLoops = 5
-		}
-		if session.TopicDecisions == nil {
-			session.TopicDecisions = map[string]string{}
-		}
-		ensureRoutingPolicyDefaults(session)
-		ensureCouncilManagerDefaults(session)
-		ensureConsultantLanguageDefaults(session)
-		ensureVisualReviewDefaults(session)
 		return session
 	}
 
@@ -340,83 +599,184 @@ func (s *MCPServer) getOrCreateSession(id string) *SessionState {
 	return session
 }
 
-func (s *MCPServer) handleTool(call toolCallRequest) (any, error) {
-	switch call.Name {
-	case "start_interview":
-		return s.toolStartInterview(call.Arguments)
-	case "ingest_intent":
-		return s.toolIngestIntent(call.Arguments)
-	case "clarify_intent":
-		return s.toolClarifyIntent(call.Arguments)
-	case "generate_plan":
-		return s.toolGeneratePlan(call.Arguments)
-	case "generate_mockup":
-		return s.toolGenerateMockup(call.Arguments)
-	case "approve_plan":
-		return s.toolApprovePlan(call.Arguments)
-	case "validate_workflow_transition":
-		return s.toolValidateTransition(call.Arguments)
-	case "run_action":
-		return s.toolRunAction(call.Arguments)
-	case "verify_result":
-		return s.toolVerifyResult(call.Arguments)
-	case "visual_review":
-		return s.toolVisualReview(call.Arguments)
-	case "summarize":
-		return s.toolSummarize(call.Arguments)
-	case "reconcile_session_state":
-		return s.toolReconcileSessionState(call.Arguments)
-	case "set_agent_routing_policy":
-		return s.toolSetAgentRoutingPolicy(call.Arguments)
-	case "get_agent_routing_policy":
-		return s.toolGetAgentRoutingPolicy(call.Arguments)
-	case "council_configure_team":
-		return s.toolCouncilConfigureTeam(call.Arguments)
-	case "council_start_briefing":
-		return s.toolCouncilStartBriefing(call.Arguments)
-	case "council_submit_brief":
-		return s.toolCouncilSubmitBrief(call.Arguments)
-	case "council_summarize_briefs":
-		return s.toolCouncilSummarizeBriefs(call.Arguments)
-	case "council_request_floor":
-		return s.toolCouncilRequestFloor(call.Arguments)
-	case "council_grant_floor":
-		return s.toolCouncilGrantFloor(call.Arguments)
-	case "council_publish_statement":
-		return s.toolCouncilPublishStatement(call.Arguments)
-	case "council_respond_topic":
-		return s.toolCouncilRespondTopic(call.Arguments)
-	case "council_close_topic":
-		return s.toolCouncilCloseTopic(call.Arguments)
-	case "council_finalize_consensus":
-		return s.toolCouncilFinalizeConsensus(call.Arguments)
-	case "council_get_status":
-		return s.toolCouncilGetStatus(call.Arguments)
-	case "record_user_feedback":
-		return s.toolRecordUserFeedback(call.Arguments)
-	case "continue_persistent_execution":
-		return s.toolContinuePersistentExecution(call.Arguments)
-	case "get_session_status":
-		return s.toolGetSessionStatus(call.Arguments)
-	case "autostart_set_mode":
-		return s.toolAutostartSetMode(call.Arguments)
-	case "autostart_get_mode":
-		return s.toolAutostartGetMode(call.Arguments)
-	case "git_get_state":
-		return s.toolGitGetState(call.Arguments)
-	case "git_diff_symbols":
-		return s.toolGitDiffSymbols(call.Arguments)
-	case "git_commit_with_context":
-		return s.toolGitCommitWithContext(call.Arguments)
-	case "git_resolve_conflict":
-		return s.toolGitResolveConflict(call.Arguments)
-	case "git_bisect_start":
-		return s.toolGitBisectStart(call.Arguments)
-	case "git_recover_state":
-		return s.toolGitRecoverState(call.Arguments)
-	default:
-		return nil, fmt.Errorf("unknown tool: %s", call.Name)
+// touchSession marks a session to be written on the next persist.
+func (s *MCPServer) touchSession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; ok {
+		s.touched[id] = true
+	}
+}
+
+// sessionLock returns the mutex guarding the session with the given ID.
+func (s *MCPServer) sessionLock(id string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.sessionLocks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.sessionLocks[id] = lock
+	}
+	return lock
+}
+
+// isSessionScopedTool reports whether a tool operates on a workflow session.
+// Autostart, git, state and session listing tools are process-, repo- or
+// store-scoped.
+func isSessionScopedTool(name string) bool {
+	switch name {
+	case "list_sessions", "search_sessions", "import_session":
+		return false
+	}
+	return !strings.HasPrefix(name, "autostart_") && !strings.HasPrefix(name, "git_") && !strings.HasPrefix(name, "state_")
+}
+
+// toolArgsSessionID extracts the session_id argument, if any.
+func toolArgsSessionID(raw json.RawMessage) string {
+	var args struct {
+		SessionID string `json:"session_id"`
+	}
+	if len(raw) == 0 {
+		return ""
+	}
+	_ = json.Unmarshal(raw, &args)
+	return strings.TrimSpace(args.SessionID)
+}
+
+// withToolArgsSessionID returns raw with session_id set to id.
+func withToolArgsSessionID(raw json.RawMessage, id string) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if len(raw) > 0 && strings.TrimSpace(string(raw)) != "null" {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	fields["session_id"] = encoded
+	return json.Marshal(fields)
+}
+
+// lockToolSession acquires the per-session lock for a tool call. Calls that
+// would create a fresh session get their ID assigned up front so the new
+// session is locked before any handler touches it.
+func (s *MCPServer) lockToolSession(call toolCallRequest) (toolCallRequest, func(), error) {
+	sessionID := toolArgsSessionID(call.Arguments)
+	named := sessionID != ""
+	if sessionID == "" {
+		if !isSessionScopedTool(call.Name) {
+			return call, func() {}, nil
+		}
+		sessionID = randomID()
+		args, err := withToolArgsSessionID(call.Arguments, sessionID)
+		if err != nil {
+			return call, nil, err
+		}
+		call.Arguments = args
+	}
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	if err := s.refreshSession(sessionID); err != nil {
+		s.logger.Warn("reloading session from store failed", "session_id", sessionID, "error", err)
+	}
+	if named && s.cfg.StrictSessionIDs && isSessionScopedTool(call.Name) && call.Name != "restore_session" && !s.hasSession(sessionID) {
+		lock.Unlock()
+		return call, nil, &toolFailure{
+			SessionID: sessionID,
+			Reason:    fmt.Sprintf("unknown session %q; find sessions with list_sessions or omit session_id to start one", sessionID),
+		}
 	}
+	return call, lock.Unlock, nil
+}
+
+// unlockedDuring runs fn with the session lock of the current tool call
+// released, so other calls on the session go ahead while fn waits. The
+// session is written first, so other processes see the state fn starts
+// from; then the lock is taken again and the session reloaded if another
+// process wrote it. fn must not touch the session. It returns the session as
+// it is afterwards, nil when it was removed meanwhile.
+func (s *MCPServer) unlockedDuring(ctx context.Context, id string, fn func()) (*SessionState, error) {
+	if held, _ := ctx.Value(heldSessionContextKey).(string); held == id {
+		if err := s.persistCallSession(id); err != nil {
+			return nil, err
+		}
+		lock := s.sessionLock(id)
+		lock.Unlock()
+		fn()
+		lock.Lock()
+		if err := s.refreshSession(id); err != nil {
+			s.logger.Warn("reloading session from store failed", "session_id", id, "error", err)
+		}
+	} else {
+		fn()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id], nil
+}
+
+// waitUnlocked runs fn with the session lock of the current tool call
+// released, like unlockedDuring, for callers that go on with the session
+// they held. It fails when the session changed meanwhile.
+func (s *MCPServer) waitUnlocked(ctx context.Context, fn func()) error {
+	id, _ := ctx.Value(heldSessionContextKey).(string)
+	s.mu.Lock()
+	session := s.sessions[id]
+	s.mu.Unlock()
+	if session == nil {
+		fn()
+		return nil
+	}
+	before, err := encodeSessionRecord(session)
+	if err != nil {
+		return err
+	}
+	after, err := s.unlockedDuring(ctx, id, fn)
+	if err != nil {
+		return err
+	}
+	if after == session {
+		rec, err := encodeSessionRecord(after)
+		if err != nil {
+			return err
+		}
+		if sameRecord(before, rec) {
+			return nil
+		}
+	}
+	return &toolFailure{Reason: "the session changed while waiting for the user's answer; check it and call again"}
+}
+
+func (s *MCPServer) handleTool(ctx context.Context, call toolCallRequest) (any, error) {
+	tool, ok := lookupTool(call.Name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownTool, call.Name)
+	}
+	if err := validateToolArguments(tool.InputSchema, call.Arguments); err != nil {
+		return nil, err
+	}
+	call, unlock, err := s.lockToolSession(call)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	sessionID := toolArgsSessionID(call.Arguments)
+	if sessionID != "" {
+		ctx = context.WithValue(ctx, heldSessionContextKey, sessionID)
+	}
+	before := s.stepTransitions(sessionID)
+	result, err := tool.handler(s, ctx, call.Arguments)
+	s.snapshotOnTransition(sessionID, call.Name, before)
+	s.touchSession(sessionID)
+	if conflict := s.persistCallSession(sessionID); conflict != nil {
+		return nil, s.toolFailureFor(call, conflict)
+	}
+	if err != nil {
+		return nil, s.toolFailureFor(call, err)
+	}
+	return result, nil
 }
 
 func mustJSON(v any) string {
@@ -451,38 +811,31 @@ func (s *MCPServer) applyDefaultUserProfile(session *SessionState, source string
 }
 
 func (s *MCPServer) loadSessions() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	raw, err := os.ReadFile(s.cfg.StatePath)
+	if s.store == nil {
+		return errSessionStoreUnavailable
+	}
+	unlock, err := s.store.lockState()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
+	defer unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	sessions := map[string]*SessionState{}
-	if err := json.Unmarshal(raw, &sessions); err != nil {
+	if imported, err := s.store.importLegacyFile(s.cfg.StatePath); err != nil {
+		// A corrupt legacy file has been quarantined; keep loading what the
+		// database holds.
+		s.logger.Error("legacy session import failed", "path", s.cfg.StatePath, "error", err)
+	} else if imported > 0 {
+		s.logger.Info("imported legacy sessions", "path", s.cfg.StatePath, "count", imported)
+	}
+	sessions, err := s.store.loadAll()
+	if err != nil {
 		return err
 	}
 
 	s.sessions = sessions
-	for _, session := range s.sessions {
-		if len(session.StepHistory) == 0 {
-			session.StepHistory = []WorkStep{session.Step}
-		}
-		if session.MaxFixLoops <= 0 {
-			session.MaxFixLoops = 5
-		}
-		if session.TopicDecisions == nil {
-			session.TopicDecisions = map[string]string{}
-		}
-		ensureRoutingPolicyDefaults(session)
-		ensureCouncilManagerDefaults(session)
-		ensureConsultantLanguageDefaults(session)
-		ensureVisualReviewDefaults(session)
-	}
+	s.touched = map[string]bool{}
 	return nil
 }
 
@@ -501,26 +854,195 @@ func ensureRoutingPolicyDefaults(session *SessionState) {
 	}
 }
 
+// persistSessions writes the sessions tool calls touched since the last
+// write to the session store. Other processes may share the store, so the
+// write holds the state file lock and picks up the sessions they wrote in the
+// meantime.
 func (s *MCPServer) persistSessions() error {
-	if s.cfg.StatePath == "" {
+	conflicts, err := s.writeSessions("")
+	for _, id := range conflicts {
+		s.logger.Warn("session was changed by another process; reloaded it and discarded this process's unsaved changes", "session_id", id)
+	}
+	return err
+}
+
+// persistCallSession writes the session of a tool call before the call
+// releases its lock. When another process changed the session during the
+// call, nothing is written: the stored copy is reloaded and the call fails,
+// so neither side's changes are lost silently.
+func (s *MCPServer) persistCallSession(id string) error {
+	if id == "" || s.store == nil {
+		return nil
+	}
+	conflicts, err := s.writeSessions(id)
+	if err != nil {
+		// The session stays touched; the write after the call retries.
+		s.logger.Warn("persisting session failed", "session_id", id, "error", err)
 		return nil
 	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return &toolFailure{Reason: "another process changed this session while the call ran; its changes were kept and this call's were discarded, so check the session and retry"}
+}
 
-	if err := os.MkdirAll(filepath.Dir(s.cfg.StatePath), 0o755); err != nil {
-		return err
+// writeSessions writes touched sessions: only held, whose lock the caller
+// holds, or with held empty every touched session no call holds. It returns
+// the sessions another process changed since they were loaded here; those
+// are not written, and their stored copy replaces the local one.
+func (s *MCPServer) writeSessions(held string) ([]string, error) {
+	if s.store == nil {
+		return nil, errSessionStoreUnavailable
+	}
+
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	unlock, err := s.store.lockState()
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
+	s.mu.Lock()
+	sessions := make(map[string]*SessionState, len(s.touched))
+	for id := range s.touched {
+		if held != "" && id != held {
+			continue
+		}
+		if session, ok := s.sessions[id]; ok {
+			sessions[id] = session
+		} else {
+			delete(s.touched, id)
+		}
+	}
+	s.mu.Unlock()
+
+	// Encode each session under its own lock. A session held by a running
+	// call is skipped and stays marked; that call persists it when it ends.
+	records := make([]sessionRecord, 0, len(sessions))
+	for id, session := range sessions {
+		lock := s.sessionLock(id)
+		if id != held && !lock.TryLock() {
+			continue
+		}
+		s.mu.Lock()
+		delete(s.touched, id)
+		s.mu.Unlock()
+		rec, err := encodeSessionRecord(session)
+		if id != held {
+			lock.Unlock()
+		}
+		if err != nil {
+			s.retouch(records)
+			s.touchSession(id)
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	result, err := s.store.save(records, nil)
+	if err != nil {
+		s.retouch(records)
+		return nil, err
+	}
+	if stored, ok := result.changed[held]; ok && held != "" {
+		delete(result.changed, held)
+		s.installStoredSession(held, stored)
+	}
+	s.applyStoreSync(result)
+	return result.conflicts, nil
+}
+
+// retouch marks the sessions of records whose write failed again, so the
+// next persist retries them.
+func (s *MCPServer) retouch(records []sessionRecord) {
+	for _, rec := range records {
+		s.touchSession(rec.id)
+	}
+}
+
+// applyStoreSync takes in what a store write saw from other processes. The
+// caller holds persistMu.
+func (s *MCPServer) applyStoreSync(result storeSync) {
+	for id, stored := range result.changed {
+		s.applyStoredSession(id, stored)
+	}
+	if result.written > 0 {
+		s.maybeBackupState()
+	}
+}
+
+// applyStoredSession replaces the local copy of a session with the one
+// another process stored. A session busy in a running call is left alone;
+// the next write sees the difference again. The caller holds persistMu.
+func (s *MCPServer) applyStoredSession(id string, stored storedSession) {
+	lock := s.sessionLock(id)
+	if !lock.TryLock() {
+		return
+	}
+	defer lock.Unlock()
+	s.installStoredSession(id, stored)
+}
+
+// installStoredSession swaps in a stored session. The caller holds persistMu
+// and the session lock.
+func (s *MCPServer) installStoredSession(id string, stored storedSession) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if stored.session == nil {
+		delete(s.sessions, id)
+	} else {
+		s.sessions[id] = stored.session
+	}
+	delete(s.touched, id)
+	s.store.accept(id, stored)
+}
 
-	raw, err := json.MarshalIndent(s.sessions, "", "  ")
+// storedCopy returns the stored form of a session, for readers that must
+// not wait on the call holding it.
+func (s *MCPServer) storedCopy(id string) (*SessionState, bool) {
+	if s.store == nil {
+		return nil, false
+	}
+	session, err := s.store.load(id)
 	if err != nil {
-		return err
+		return nil, false
 	}
+	return session, true
+}
 
-	tmp := s.cfg.StatePath + ".tmp"
-	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+// refreshSession reloads a session that another process wrote since this
+// process last saw it, unless the local copy has unsaved changes. Tool calls
+// run it after taking the session lock so they act on the latest state.
+func (s *MCPServer) refreshSession(id string) error {
+	if s.store == nil {
+		return nil
+	}
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	revision, exists, err := s.store.storedRevision(id)
+	if err != nil || !exists {
 		return err
 	}
-	return os.Rename(tmp, s.cfg.StatePath)
+	prev, known := s.store.written[id]
+	if known && prev.revision == revision {
+		return nil
+	}
+	s.mu.Lock()
+	local := s.sessions[id]
+	s.mu.Unlock()
+	if local != nil {
+		rec, err := encodeSessionRecord(local)
+		if err != nil {
+			return err
+		}
+		if !known || !sameRecord(prev, rec) {
+			return nil
+		}
+	}
+	session, rec, err := loadSession(s.store.db, id)
+	if err != nil {
+		return err
+	}
+	s.installStoredSession(id, storedSession{session: session, rec: rec})
+	return nil
 }
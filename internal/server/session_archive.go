@@ -0,0 +1,404 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionArchiveFormat versions the bundle layout. Format 1 bundles
+	// hold council rows as captured by sessionRows; later ones hold a
+	// councilExport.
+	sessionArchiveFormat = 2
+	// sessionArchiveSuffix ends every archived session file name.
+	sessionArchiveSuffix = ".json.gz"
+)
+
+// RetentionPolicy decides which sessions pruning archives. Zero values
+// disable a rule.
+type RetentionPolicy struct {
+	// SummarizedMaxAge archives summarized sessions not updated for this
+	// long.
+	SummarizedMaxAge time.Duration
+	// MaxSessions archives the least recently updated sessions beyond this
+	// count.
+	MaxSessions int
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.SummarizedMaxAge > 0 || p.MaxSessions > 0
+}
+
+// sessionArchive is a session bundle: the session, its snapshots and its
+// council rows. How Council is encoded depends on Format; see
+// restoreArchivedCouncil.
+type sessionArchive struct {
+	Format     int               `json:"format"`
+	ArchivedAt time.Time         `json:"archived_at"`
+	Reason     string            `json:"reason"`
+	Session    json.RawMessage   `json:"session"`
+	Snapshots  []SessionSnapshot `json:"snapshots"`
+	Council    json.RawMessage   `json:"council"`
+}
+
+// PrunedSession is a session selected by the retention policy.
+type PrunedSession struct {
+	SessionID string    `json:"session_id"`
+	Step      WorkStep  `json:"step"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Reason    string    `json:"reason"`
+	Archive   string    `json:"archive"`
+}
+
+func sessionArchiveDir(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), "archive")
+}
+
+// checkSessionIDPath rejects IDs that cannot name a file or directory in
+// the state directory.
+func checkSessionIDPath(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return fmt.Errorf("invalid session id %q", id)
+	}
+	return nil
+}
+
+func (s *MCPServer) sessionArchivePath(id string) (string, error) {
+	if err := checkSessionIDPath(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(sessionArchiveDir(s.cfg.DiscussionDBPath), id+sessionArchiveSuffix), nil
+}
+
+// bundleSession captures a session with its snapshots and council rows. The
+// caller holds the session lock.
+func (s *MCPServer) bundleSession(session *SessionState, reason string) (sessionArchive, error) {
+	state, err := json.Marshal(session)
+	if err != nil {
+		return sessionArchive{}, err
+	}
+	export := councilExport{}
+	if s.council != nil {
+		if export, err = s.council.exportCouncil(session.SessionID); err != nil {
+			return sessionArchive{}, err
+		}
+	}
+	council, err := json.Marshal(export)
+	if err != nil {
+		return sessionArchive{}, err
+	}
+	return sessionArchive{
+		Format:     sessionArchiveFormat,
+		ArchivedAt: time.Now().UTC(),
+		Reason:     reason,
+		Session:    state,
+		Snapshots:  session.Snapshots,
+		Council:    council,
+	}, nil
+}
+
+// unbundleSession decodes the session in a bundle and upgrades it.
+func unbundleSession(bundle sessionArchive) (*SessionState, error) {
+	if bundle.Format > sessionArchiveFormat {
+		return nil, fmt.Errorf("%w: session bundle format %d, supported up to %d", ErrSchemaTooNew, bundle.Format, sessionArchiveFormat)
+	}
+	session := &SessionState{}
+	if err := json.Unmarshal(bundle.Session, session); err != nil {
+		return nil, fmt.Errorf("invalid session bundle: %w", err)
+	}
+	if session.SessionID == "" {
+		return nil, errors.New("invalid session bundle: missing session_id")
+	}
+	if err := upgradeSession(session); err != nil {
+		return nil, err
+	}
+	session.Snapshots = bundle.Snapshots
+	return session, nil
+}
+
+// writeGzipJSON writes v as gzip-compressed JSON, atomically.
+func writeGzipJSON(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readGzipJSON(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer zr.Close()
+	if err := json.NewDecoder(zr).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// archiveSession moves a session and its council rows into an archive
+// bundle and deletes them from the database. The caller holds the session
+// lock.
+func (s *MCPServer) archiveSession(session *SessionState, reason string) (string, error) {
+	if s.store == nil {
+		return "", errSessionStoreUnavailable
+	}
+	path, err := s.sessionArchivePath(session.SessionID)
+	if err != nil {
+		return "", err
+	}
+	bundle, err := s.bundleSession(session, reason)
+	if err != nil {
+		return "", err
+	}
+	if err := writeGzipJSON(path, bundle); err != nil {
+		return "", err
+	}
+	if err := s.dropSessionNow(session.SessionID); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// restoreArchivedSession brings an archived session back and removes its
+// bundle. The caller holds the session lock.
+func (s *MCPServer) restoreArchivedSession(id string) (*SessionState, error) {
+	if s.store == nil {
+		return nil, errSessionStoreUnavailable
+	}
+	path, err := s.sessionArchivePath(id)
+	if err != nil {
+		return nil, err
+	}
+	var bundle sessionArchive
+	err = readGzipJSON(path, &bundle)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no archived session %q", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	session, err := unbundleSession(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if session.SessionID != id {
+		return nil, fmt.Errorf("archive %s holds session %q", path, session.SessionID)
+	}
+	err = s.installSessionNow(session, func() error {
+		return s.restoreArchivedCouncil(id, bundle)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		s.logger.Warn("removing restored session archive failed", "path", path, "error", err)
+	}
+	return session, nil
+}
+
+// restoreArchivedCouncil writes a bundle's council rows under id. Format 1
+// bundles carry raw rows, which are put back as they were.
+func (s *MCPServer) restoreArchivedCouncil(id string, bundle sessionArchive) error {
+	if bundle.Format < 2 {
+		return s.council.restoreSessionRows(id, bundle.Council)
+	}
+	var export councilExport
+	if err := json.Unmarshal(bundle.Council, &export); err != nil {
+		return fmt.Errorf("invalid council data in session bundle: %w", err)
+	}
+	return s.council.importCouncil(id, export)
+}
+
+// installSessionNow adds a session that does not exist yet and writes it at
+// once. writeCouncil puts its council rows in place first; if anything fails
+// those rows are deleted again. The caller holds the session lock.
+func (s *MCPServer) installSessionNow(session *SessionState, writeCouncil func() error) error {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	unlock, err := s.store.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, exists, err := s.store.storedRevision(session.SessionID); err != nil {
+		return err
+	} else if exists || s.hasSession(session.SessionID) {
+		return fmt.Errorf("session %q already exists", session.SessionID)
+	}
+	if err := s.writeNewSession(session, writeCouncil); err != nil {
+		// No session has this ID, so any council rows under it are this
+		// install's.
+		if delErr := s.council.deleteSessionRows(session.SessionID); delErr != nil {
+			s.logger.Warn("removing council rows of a failed install failed", "session_id", session.SessionID, "error", delErr)
+		}
+		return err
+	}
+	s.mu.Lock()
+	s.sessions[session.SessionID] = session
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MCPServer) writeNewSession(session *SessionState, writeCouncil func() error) error {
+	if err := writeCouncil(); err != nil {
+		return err
+	}
+	rec, err := encodeSessionRecord(session)
+	if err != nil {
+		return err
+	}
+	result, err := s.store.save([]sessionRecord{rec}, nil)
+	if err != nil {
+		return err
+	}
+	s.applyStoreSync(result)
+	return nil
+}
+
+// dropSessionNow deletes a session and its council rows from the database
+// and from memory. The caller holds the session lock.
+func (s *MCPServer) dropSessionNow(id string) error {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	unlock, err := s.store.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.council.deleteSessionRows(id); err != nil {
+		return err
+	}
+	result, err := s.store.save(nil, []string{id})
+	if err != nil {
+		return err
+	}
+	s.applyStoreSync(result)
+	s.mu.Lock()
+	delete(s.sessions, id)
+	delete(s.touched, id)
+	if s.autostartSessionID == id {
+		s.autostartSessionID = ""
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// ListArchivedSessions returns the archived sessions matching filter,
+// newest first.
+func (s *MCPServer) ListArchivedSessions(filter SessionFilter) (SessionPage, error) {
+	paths, err := filepath.Glob(filepath.Join(sessionArchiveDir(s.cfg.DiscussionDBPath), "*"+sessionArchiveSuffix))
+	if err != nil {
+		return SessionPage{}, err
+	}
+	matched := []SessionSummary{}
+	for _, path := range paths {
+		var bundle sessionArchive
+		if err := readGzipJSON(path, &bundle); err != nil {
+			s.logger.Warn("skipping unreadable session archive", "path", path, "error", err)
+			continue
+		}
+		session := &SessionState{}
+		if err := json.Unmarshal(bundle.Session, session); err != nil {
+			s.logger.Warn("skipping unreadable session archive", "path", path, "error", err)
+			continue
+		}
+		if filter.matches(session) {
+			matched = append(matched, summarizeSession(session))
+		}
+	}
+	return pageSessions(matched, filter), nil
+}
+
+// PruneSessions archives the sessions Config.Retention selects, or only
+// reports them when dryRun is set. Sessions busy in a running call and the
+// autostart session are kept.
+func (s *MCPServer) PruneSessions(dryRun bool) ([]PrunedSession, error) {
+	policy := s.cfg.Retention
+	pruned := []PrunedSession{}
+	if !policy.enabled() {
+		return pruned, nil
+	}
+	_, active := s.autostartState()
+	s.mu.Lock()
+	sessions := make([]*SessionState, 0, len(s.sessions))
+	for id, session := range s.sessions {
+		if id != active {
+			sessions = append(sessions, session)
+		}
+	}
+	s.mu.Unlock()
+	// Oldest first, so the count cap drops the least recently updated.
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].UpdatedAt.Before(sessions[j].UpdatedAt) })
+
+	now := time.Now().UTC()
+	over := 0
+	if policy.MaxSessions > 0 {
+		over = max(len(sessions)-policy.MaxSessions, 0)
+	}
+	for _, session := range sessions {
+		lock := s.sessionLock(session.SessionID)
+		if !lock.TryLock() {
+			continue
+		}
+		reason := ""
+		switch {
+		case policy.SummarizedMaxAge > 0 && session.Step == StepSummarized && now.Sub(session.UpdatedAt) > policy.SummarizedMaxAge:
+			reason = fmt.Sprintf("summarized and idle for more than %s", policy.SummarizedMaxAge)
+		case over > 0:
+			reason = fmt.Sprintf("over the %d session cap", policy.MaxSessions)
+		}
+		if reason == "" {
+			lock.Unlock()
+			continue
+		}
+		over--
+		entry := PrunedSession{SessionID: session.SessionID, Step: session.Step, UpdatedAt: session.UpdatedAt, Reason: reason}
+		if dryRun {
+			entry.Archive, _ = s.sessionArchivePath(session.SessionID)
+		} else {
+			path, err := s.archiveSession(session, reason)
+			if err != nil {
+				lock.Unlock()
+				return pruned, fmt.Errorf("archiving session %s: %w", session.SessionID, err)
+			}
+			entry.Archive = path
+		}
+		lock.Unlock()
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
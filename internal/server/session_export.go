@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionExportFormat versions the export bundle layout.
+	sessionExportFormat = 1
+	// maxExportArtifactBytes caps the size of an artifact file embedded in
+	// an export; larger files are listed as skipped.
+	maxExportArtifactBytes = 20 << 20
+)
+
+// sessionExport is a portable session bundle. Checksum is the SHA-256 of
+// the compact Payload, so a damaged or edited bundle is refused on import.
+type sessionExport struct {
+	Format          int             `json:"format"`
+	ExportedAt      time.Time       `json:"exported_at"`
+	Version         string          `json:"codex_mcp_version"`
+	SourceSessionID string          `json:"source_session_id"`
+	Checksum        string          `json:"checksum"`
+	Payload         json.RawMessage `json:"payload"`
+}
+
+type sessionExportPayload struct {
+	Session   json.RawMessage    `json:"session"`
+	Council   councilExport      `json:"council"`
+	Artifacts []exportedArtifact `json:"artifacts"`
+}
+
+// exportedArtifact is an artifact file the session recorded, embedded so
+// the bundle does not depend on the exporting machine's paths.
+type exportedArtifact struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Data   []byte `json:"data"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *MCPServer) defaultExportPath(id string) string {
+	return filepath.Join(filepath.Dir(s.cfg.DiscussionDBPath), "exports", id+"-"+time.Now().UTC().Format("20060102T150405Z")+".json.gz")
+}
+
+// exportSession writes a session, its council rows and its artifact files
+// to one bundle. It returns the artifacts that were left out. The caller
+// holds the session lock.
+func (s *MCPServer) exportSession(session *SessionState, path string) ([]string, error) {
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	payload := sessionExportPayload{Session: state, Artifacts: []exportedArtifact{}}
+	if s.council != nil {
+		if payload.Council, err = s.council.exportCouncil(session.SessionID); err != nil {
+			return nil, err
+		}
+	}
+	skipped := []string{}
+	for _, artifact := range session.VisualReview.Artifacts {
+		item, ok := s.readArtifact(artifact)
+		if !ok {
+			skipped = append(skipped, artifact)
+			continue
+		}
+		payload.Artifacts = append(payload.Artifacts, item)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	bundle := sessionExport{
+		Format:          sessionExportFormat,
+		ExportedAt:      time.Now().UTC(),
+		Version:         s.cfg.Version,
+		SourceSessionID: session.SessionID,
+		Checksum:        sha256Hex(raw),
+		Payload:         raw,
+	}
+	return skipped, writeGzipJSON(path, bundle)
+}
+
+// readArtifact loads an artifact that is a local file small enough to
+// embed. URLs and missing files are not embedded.
+func (s *MCPServer) readArtifact(artifact string) (exportedArtifact, bool) {
+	if strings.Contains(artifact, "://") {
+		return exportedArtifact{}, false
+	}
+	path := artifact
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.cfg.WorkDir, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxExportArtifactBytes {
+		return exportedArtifact{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return exportedArtifact{}, false
+	}
+	return exportedArtifact{
+		Path:   artifact,
+		Name:   filepath.Base(path),
+		Size:   int64(len(data)),
+		SHA256: sha256Hex(data),
+		Data:   data,
+	}, true
+}
+
+// readSessionExport reads a bundle and verifies its checksum, schema and
+// contents.
+func readSessionExport(path string) (sessionExport, sessionExportPayload, *SessionState, error) {
+	var bundle sessionExport
+	if err := readGzipJSON(path, &bundle); err != nil {
+		return sessionExport{}, sessionExportPayload{}, nil, err
+	}
+	if bundle.Format > sessionExportFormat {
+		return sessionExport{}, sessionExportPayload{}, nil, fmt.Errorf("%w: export format %d, supported up to %d", ErrSchemaTooNew, bundle.Format, sessionExportFormat)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, bundle.Payload); err != nil {
+		return sessionExport{}, sessionExportPayload{}, nil, fmt.Errorf("invalid export payload: %w", err)
+	}
+	if got := sha256Hex(compact.Bytes()); got != bundle.Checksum {
+		return sessionExport{}, sessionExportPayload{}, nil, fmt.Errorf("export checksum mismatch: bundle says %s, payload hashes to %s", bundle.Checksum, got)
+	}
+	var payload sessionExportPayload
+	if err := json.Unmarshal(bundle.Payload, &payload); err != nil {
+		return sessionExport{}, sessionExportPayload{}, nil, fmt.Errorf("invalid export payload: %w", err)
+	}
+	session, err := unbundleSession(sessionArchive{Format: sessionArchiveFormat, Session: payload.Session})
+	if err != nil {
+		return sessionExport{}, sessionExportPayload{}, nil, err
+	}
+	if err := payload.Council.validate(); err != nil {
+		return sessionExport{}, sessionExportPayload{}, nil, fmt.Errorf("invalid council data: %w", err)
+	}
+	for _, artifact := range payload.Artifacts {
+		if sha256Hex(artifact.Data) != artifact.SHA256 || int64(len(artifact.Data)) != artifact.Size {
+			return sessionExport{}, sessionExportPayload{}, nil, fmt.Errorf("artifact %s does not match its checksum", artifact.Path)
+		}
+	}
+	return bundle, payload, session, nil
+}
+
+// importSession installs the session in a bundle under newID, writing its
+// artifact files next to the state database and pointing the session at
+// them. The files are staged in a temporary directory and moved into place
+// only once the session is installed, so a failed import leaves no files
+// behind. The caller holds newID's session lock.
+func (s *MCPServer) importSession(session *SessionState, payload sessionExportPayload, newID string) error {
+	if s.store == nil {
+		return errSessionStoreUnavailable
+	}
+	if err := checkSessionIDPath(newID); err != nil {
+		return err
+	}
+	if _, exists, err := s.store.storedRevision(newID); err != nil {
+		return err
+	} else if exists || s.hasSession(newID) {
+		return fmt.Errorf("session %q already exists", newID)
+	}
+	root := filepath.Join(filepath.Dir(s.cfg.DiscussionDBPath), "artifacts")
+	dir := filepath.Join(root, newID)
+	staging := ""
+	defer func() {
+		if staging != "" {
+			_ = os.RemoveAll(staging)
+		}
+	}()
+	moved := map[string]string{}
+	used := map[string]bool{}
+	for i, artifact := range payload.Artifacts {
+		name := filepath.Base(filepath.Clean("/" + artifact.Name))
+		if name == "/" || used[name] {
+			name = fmt.Sprintf("%d-%s", i, strings.TrimPrefix(name, "/"))
+		}
+		used[name] = true
+		if staging == "" {
+			if err := os.MkdirAll(root, 0o755); err != nil {
+				return err
+			}
+			tmp, err := os.MkdirTemp(root, ".import-")
+			if err != nil {
+				return err
+			}
+			staging = tmp
+		}
+		if err := os.WriteFile(filepath.Join(staging, name), artifact.Data, 0o644); err != nil {
+			return err
+		}
+		moved[artifact.Path] = filepath.Join(dir, name)
+	}
+	for i, artifact := range session.VisualReview.Artifacts {
+		if target, ok := moved[artifact]; ok {
+			session.VisualReview.Artifacts[i] = target
+		}
+	}
+
+	session.SessionID = newID
+	// Fork links name sessions in the exporting state directory.
+	session.ForkedFrom = ""
+	session.Forks = nil
+	session.Snapshots = nil
+	if err := s.installSessionNow(session, func() error {
+		return s.council.importCouncil(newID, payload.Council)
+	}); err != nil {
+		return err
+	}
+	if staging == "" {
+		return nil
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		if dropErr := s.dropSessionNow(newID); dropErr != nil {
+			s.logger.Warn("dropping imported session failed", "session_id", newID, "error", dropErr)
+		}
+		return fmt.Errorf("moving imported artifacts into place: %w", err)
+	}
+	staging = ""
+	return nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSessionPageSize = 20
+	maxSessionPageSize     = 100
+)
+
+// SessionFilter selects sessions for ListSessions. Empty fields match
+// every session.
+type SessionFilter struct {
+	Step string
+	// Goal matches the intent goal, case-insensitively.
+	Goal string
+	// Query matches the session ID, goal, raw intent or any tag.
+	Query         string
+	Branch        string
+	Tags          []string
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Offset        int
+	Limit         int
+}
+
+// SessionSummary is one row of a session listing.
+type SessionSummary struct {
+	SessionID       string    `json:"session_id"`
+	Step            WorkStep  `json:"step"`
+	Goal            string    `json:"goal"`
+	Branch          string    `json:"branch"`
+	RequirementTags []string  `json:"requirement_tags"`
+	ForkedFrom      string    `json:"forked_from"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SessionPage is a page of matching sessions, newest first. NextOffset is
+// zero when there are no more pages.
+type SessionPage struct {
+	Sessions   []SessionSummary `json:"sessions"`
+	Total      int              `json:"total"`
+	NextOffset int              `json:"next_offset"`
+}
+
+func (f SessionFilter) matches(session *SessionState) bool {
+	if f.Step != "" && string(session.Step) != f.Step {
+		return false
+	}
+	if f.Goal != "" && !containsFold(session.Intent.Goal, f.Goal) {
+		return false
+	}
+	if f.Branch != "" && session.BaselineFootprint.Branch != f.Branch {
+		return false
+	}
+	if !f.UpdatedAfter.IsZero() && session.UpdatedAt.Before(f.UpdatedAfter) {
+		return false
+	}
+	if !f.UpdatedBefore.IsZero() && session.UpdatedAt.After(f.UpdatedBefore) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !hasTagFold(session.RequirementTags, tag) {
+			return false
+		}
+	}
+	if f.Query != "" {
+		if !containsFold(session.SessionID, f.Query) &&
+			!containsFold(session.Intent.Goal, f.Query) &&
+			!containsFold(session.Intent.Raw, f.Query) &&
+			!hasTagFold(session.RequirementTags, f.Query) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(strings.TrimSpace(substr)))
+}
+
+func hasTagFold(tags []string, want string) bool {
+	for _, tag := range tags {
+		if strings.EqualFold(strings.TrimSpace(tag), strings.TrimSpace(want)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListSessions returns the sessions matching filter, newest first. Sessions
+// busy in a running call are listed from their last saved state.
+func (s *MCPServer) ListSessions(filter SessionFilter) SessionPage {
+	s.mu.Lock()
+	sessions := make([]*SessionState, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	matched := []SessionSummary{}
+	for _, session := range sessions {
+		lock := s.sessionLock(session.SessionID)
+		if lock.TryLock() {
+			if filter.matches(session) {
+				matched = append(matched, summarizeSession(session))
+			}
+			lock.Unlock()
+			continue
+		}
+		// A session busy in a running call is matched on its stored
+		// copy, as sessionSnapshot serves it.
+		saved, ok := s.storedCopy(session.SessionID)
+		if !ok {
+			continue
+		}
+		if filter.matches(saved) {
+			matched = append(matched, summarizeSession(saved))
+		}
+	}
+	return pageSessions(matched, filter)
+}
+
+// pageSessions sorts matched sessions newest first and cuts the page the
+// filter asks for.
+func pageSessions(matched []SessionSummary, filter SessionFilter) SessionPage {
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].UpdatedAt.Equal(matched[j].UpdatedAt) {
+			return matched[i].UpdatedAt.After(matched[j].UpdatedAt)
+		}
+		return matched[i].SessionID < matched[j].SessionID
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultSessionPageSize
+	}
+	limit = min(limit, maxSessionPageSize)
+	offset := max(filter.Offset, 0)
+	page := SessionPage{Sessions: []SessionSummary{}, Total: len(matched)}
+	if offset < len(matched) {
+		end := min(offset+limit, len(matched))
+		page.Sessions = matched[offset:end]
+		if end < len(matched) {
+			page.NextOffset = end
+		}
+	}
+	return page
+}
+
+func summarizeSession(session *SessionState) SessionSummary {
+	return SessionSummary{
+		SessionID:       session.SessionID,
+		Step:            session.Step,
+		Goal:            session.Intent.Goal,
+		Branch:          session.BaselineFootprint.Branch,
+		RequirementTags: append([]string{}, session.RequirementTags...),
+		ForkedFrom:      session.ForkedFrom,
+		CreatedAt:       session.CreatedAt,
+		UpdatedAt:       session.UpdatedAt,
+	}
+}
+
+// ParseSessionTime parses a listing bound given as an RFC 3339 timestamp or
+// a date. An empty value is the zero time, which does not filter.
+func ParseSessionTime(field, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or YYYY-MM-DD date, got %q", field, value)
+}
@@ -0,0 +1,622 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// legacyImportSuffix is appended to a sessions.json file once its sessions
+// have been imported, so the import runs only once.
+const legacyImportSuffix = ".imported"
+
+var errSessionStoreUnavailable = errors.New("session store is not available")
+
+// sessionStore persists workflow sessions in the council database: one row
+// per session plus child tables for the lists that grow with every call.
+type sessionStore struct {
+	db *sql.DB
+	// lock serializes reload-and-write with other processes sharing the
+	// database; nil when the store is used by a single process.
+	lock *stateFileLock
+	// written caches what was last stored or loaded per session, so a save
+	// only touches rows that changed. Its revisions tell which sessions
+	// another process wrote since.
+	written map[string]sessionRecord
+}
+
+// sessionRecord is a session split into its row and child-table rows. The
+// row keeps the session JSON without the child lists.
+type sessionRecord struct {
+	id        string
+	step      string
+	base      string
+	createdAt string
+	updatedAt string
+	lists     map[string][][]any
+	// revision counts writes of the session row across processes.
+	revision int64
+}
+
+// storedSession is a session another process wrote or removed since this
+// process last saw it. session is nil when it was removed.
+type storedSession struct {
+	session *SessionState
+	rec     sessionRecord
+}
+
+// storeSync reports a save: how many sessions were written or removed, the
+// sessions other processes changed in the meantime, and the sessions both
+// sides changed. Those conflicts are not written; their stored copy is in
+// changed.
+type storeSync struct {
+	written   int
+	changed   map[string]storedSession
+	conflicts []string
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sessionList maps one list field of SessionState to a child table. Rows are
+// keyed by (session_id, seq); values are the columns after seq.
+type sessionList struct {
+	name   string
+	delete string
+	insert string
+	query  string
+	encode func(*SessionState) [][]any
+	decode func(*SessionState, *sql.Rows) error
+}
+
+var sessionLists = []sessionList{
+	{
+		name:   "step_history",
+		delete: `DELETE FROM session_step_history WHERE session_id=? AND seq>=?`,
+		insert: `INSERT INTO session_step_history(session_id,seq,step) VALUES(?,?,?)`,
+		query:  `SELECT step FROM session_step_history WHERE session_id=? ORDER BY seq`,
+		encode: func(session *SessionState) [][]any {
+			out := make([][]any, 0, len(session.StepHistory))
+			for _, step := range session.StepHistory {
+				out = append(out, []any{string(step)})
+			}
+			return out
+		},
+		decode: func(session *SessionState, rows *sql.Rows) error {
+			var step string
+			if err := rows.Scan(&step); err != nil {
+				return err
+			}
+			session.StepHistory = append(session.StepHistory, WorkStep(step))
+			return nil
+		},
+	},
+	commandResultList("action_results", "action", func(session *SessionState) *[]CommandResult { return &session.ActionResults }),
+	commandResultList("verify_results", "verify", func(session *SessionState) *[]CommandResult { return &session.VerifyResults }),
+	{
+		name:   "user_feedback",
+		delete: `DELETE FROM session_feedback WHERE session_id=? AND seq>=?`,
+		insert: `INSERT INTO session_feedback(session_id,seq,feedback) VALUES(?,?,?)`,
+		query:  `SELECT feedback FROM session_feedback WHERE session_id=? ORDER BY seq`,
+		encode: func(session *SessionState) [][]any {
+			out := make([][]any, 0, len(session.UserFeedback))
+			for _, feedback := range session.UserFeedback {
+				out = append(out, []any{feedback})
+			}
+			return out
+		},
+		decode: func(session *SessionState, rows *sql.Rows) error {
+			var feedback string
+			if err := rows.Scan(&feedback); err != nil {
+				return err
+			}
+			session.UserFeedback = append(session.UserFeedback, feedback)
+			return nil
+		},
+	},
+	{
+		name:   "plan_versions",
+		delete: `DELETE FROM session_plan_versions WHERE session_id=? AND seq>=?`,
+		insert: `INSERT INTO session_plan_versions(session_id,seq,version,body_json) VALUES(?,?,?,?)`,
+		query:  `SELECT body_json FROM session_plan_versions WHERE session_id=? ORDER BY seq`,
+		encode: func(session *SessionState) [][]any {
+			out := make([][]any, 0, len(session.PlanVersions))
+			for _, version := range session.PlanVersions {
+				// PlanVersion holds only plain values, so it always marshals.
+				body, _ := json.Marshal(version)
+				out = append(out, []any{version.Version, string(body)})
+			}
+			return out
+		},
+		decode: func(session *SessionState, rows *sql.Rows) error {
+			var body string
+			if err := rows.Scan(&body); err != nil {
+				return err
+			}
+			var version PlanVersion
+			if err := json.Unmarshal([]byte(body), &version); err != nil {
+				return fmt.Errorf("decoding plan version: %w", err)
+			}
+			session.PlanVersions = append(session.PlanVersions, version)
+			return nil
+		},
+	},
+	{
+		name:   "snapshots",
+		delete: `DELETE FROM session_snapshots WHERE session_id=? AND seq>=?`,
+		insert: `INSERT INTO session_snapshots(session_id,seq,step,reason,state_json,council_json,created_at) VALUES(?,?,?,?,?,?,?)`,
+		query:  `SELECT step,reason,state_json,council_json,created_at FROM session_snapshots WHERE session_id=? ORDER BY seq`,
+		encode: func(session *SessionState) [][]any {
+			out := make([][]any, 0, len(session.Snapshots))
+			for _, snap := range session.Snapshots {
+				out = append(out, []any{string(snap.Step), snap.Reason, string(snap.State), string(snap.Council), snap.At.UTC().Format(time.RFC3339Nano)})
+			}
+			return out
+		},
+		decode: func(session *SessionState, rows *sql.Rows) error {
+			var snap SessionSnapshot
+			var step, state, council, at string
+			if err := rows.Scan(&step, &snap.Reason, &state, &council, &at); err != nil {
+				return err
+			}
+			snap.Step = WorkStep(step)
+			snap.State = json.RawMessage(state)
+			snap.Council = json.RawMessage(council)
+			snap.At = parseTimeOrZero(at)
+			session.Snapshots = append(session.Snapshots, snap)
+			return nil
+		},
+	},
+}
+
+func commandResultList(name, kind string, field func(*SessionState) *[]CommandResult) sessionList {
+	return sessionList{
+		name:   name,
+		delete: `DELETE FROM session_command_results WHERE session_id=? AND kind='` + kind + `' AND seq>=?`,
+		insert: `INSERT INTO session_command_results(session_id,seq,kind,command,exit_code,stdout,stderr,duration_ms,status,error,redactions,item_id)
+			 VALUES(?,?,'` + kind + `',?,?,?,?,?,?,?,?,?)`,
+		query: `SELECT command,exit_code,stdout,stderr,duration_ms,status,error,redactions,item_id
+			 FROM session_command_results WHERE session_id=? AND kind='` + kind + `' ORDER BY seq`,
+		encode: func(session *SessionState) [][]any {
+			results := *field(session)
+			out := make([][]any, 0, len(results))
+			for _, r := range results {
+				out = append(out, []any{r.Command, r.ExitCode, r.Stdout, r.Stderr, r.DurationMS, r.Status, r.Error, r.Redactions, r.ItemID})
+			}
+			return out
+		},
+		decode: func(session *SessionState, rows *sql.Rows) error {
+			var r CommandResult
+			if err := rows.Scan(&r.Command, &r.ExitCode, &r.Stdout, &r.Stderr, &r.DurationMS, &r.Status, &r.Error, &r.Redactions, &r.ItemID); err != nil {
+				return err
+			}
+			*field(session) = append(*field(session), r)
+			return nil
+		},
+	}
+}
+
+// lockState takes the state file lock shared with other processes.
+func (st *sessionStore) lockState() (func(), error) {
+	if st.lock == nil {
+		return func() {}, nil
+	}
+	return st.lock.lock()
+}
+
+// newSessionStore uses tables created by the database migrations.
+func newSessionStore(db *sql.DB) *sessionStore {
+	return &sessionStore{db: db, written: map[string]sessionRecord{}}
+}
+
+// encodeSessionRecord splits a session for storage. The caller holds the
+// session lock.
+func encodeSessionRecord(session *SessionState) (sessionRecord, error) {
+	base := *session
+	base.StepHistory = nil
+	base.ActionResults = nil
+	base.VerifyResults = nil
+	base.UserFeedback = nil
+	base.PlanVersions = nil
+	raw, err := json.Marshal(base)
+	if err != nil {
+		return sessionRecord{}, err
+	}
+	rec := sessionRecord{
+		id:        session.SessionID,
+		step:      string(session.Step),
+		base:      string(raw),
+		createdAt: session.CreatedAt.UTC().Format(time.RFC3339Nano),
+		updatedAt: session.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		lists:     make(map[string][][]any, len(sessionLists)),
+	}
+	for _, list := range sessionLists {
+		rec.lists[list.name] = list.encode(session)
+	}
+	return rec, nil
+}
+
+// firstChangedRow returns the index from which rows differ from prev.
+func firstChangedRow(prev, next [][]any) int {
+	i := 0
+	for i < len(prev) && i < len(next) && rowEqual(prev[i], next[i]) {
+		i++
+	}
+	return i
+}
+
+// sameRecord reports whether two records hold the same session content.
+func sameRecord(a, b sessionRecord) bool {
+	if a.base != b.base {
+		return false
+	}
+	for _, list := range sessionLists {
+		prev, next := a.lists[list.name], b.lists[list.name]
+		if len(prev) != len(next) || firstChangedRow(prev, next) != len(next) {
+			return false
+		}
+	}
+	return true
+}
+
+func rowEqual(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// save writes the given sessions in one transaction, touching only the rows
+// that changed since the last save or load. removed lists sessions that no
+// longer exist. Sessions other processes changed since this one last saw
+// them are read back in the same transaction and reported in changed; a
+// session changed on both sides is left as stored and reported in conflicts.
+func (st *sessionStore) save(records []sessionRecord, removed []string) (result storeSync, err error) {
+	type change struct {
+		rec     sessionRecord
+		baseNew bool
+		from    map[string]int
+	}
+	dirty := len(removed) > 0
+	for _, rec := range records {
+		if prev, known := st.written[rec.id]; !known || !sameRecord(prev, rec) {
+			dirty = true
+			break
+		}
+	}
+	if !dirty {
+		// Nothing to write; only pick up what other processes wrote.
+		stored, err := storedRevisions(st.db)
+		if err != nil {
+			return storeSync{}, err
+		}
+		changed, err := st.changedSessions(st.db, stored, nil, nil)
+		return storeSync{changed: changed}, err
+	}
+
+	tx, err := beginTx(st.db)
+	if err != nil {
+		return storeSync{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	stored, err := storedRevisions(tx)
+	if err != nil {
+		return storeSync{}, err
+	}
+
+	changes := []change{}
+	local := map[string]bool{}
+	for _, rec := range records {
+		prev, known := st.written[rec.id]
+		if known && sameRecord(prev, rec) {
+			continue
+		}
+		revision, exists := stored[rec.id]
+		if exists != known || revision != prev.revision {
+			// Another process wrote or removed this session since it
+			// was last seen here. Writing the local copy would drop
+			// that change, so the stored copy is read back instead.
+			result.conflicts = append(result.conflicts, rec.id)
+			continue
+		}
+		local[rec.id] = true
+		rec.revision = revision + 1
+		c := change{rec: rec, baseNew: !known || prev.base != rec.base, from: map[string]int{}}
+		for _, list := range sessionLists {
+			from := firstChangedRow(prev.lists[list.name], rec.lists[list.name])
+			if !known || from < len(prev.lists[list.name]) || from < len(rec.lists[list.name]) {
+				c.from[list.name] = from
+			}
+		}
+		changes = append(changes, c)
+	}
+	if result.changed, err = st.changedSessions(tx, stored, local, removed); err != nil {
+		return storeSync{}, err
+	}
+
+	for _, c := range changes {
+		if c.baseNew {
+			if _, err = tx.Exec(
+				`INSERT INTO sessions(session_id,step,state_json,created_at,updated_at,revision)
+				 VALUES(?,?,?,?,?,?)
+				 ON CONFLICT(session_id) DO UPDATE SET step=excluded.step, state_json=excluded.state_json, updated_at=excluded.updated_at, revision=excluded.revision`,
+				c.rec.id, c.rec.step, c.rec.base, c.rec.createdAt, c.rec.updatedAt, c.rec.revision,
+			); err != nil {
+				return storeSync{}, err
+			}
+		} else if _, err = tx.Exec(`UPDATE sessions SET revision=? WHERE session_id=?`, c.rec.revision, c.rec.id); err != nil {
+			return storeSync{}, err
+		}
+		for _, list := range sessionLists {
+			from, ok := c.from[list.name]
+			if !ok {
+				continue
+			}
+			if err = writeSessionList(tx, list, c.rec.id, from, c.rec.lists[list.name]); err != nil {
+				return storeSync{}, err
+			}
+		}
+	}
+	for _, id := range removed {
+		if err = deleteSessionRows(tx, id); err != nil {
+			return storeSync{}, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return storeSync{}, err
+	}
+	for _, c := range changes {
+		st.written[c.rec.id] = c.rec
+	}
+	for _, id := range removed {
+		delete(st.written, id)
+	}
+	result.written = len(changes) + len(removed)
+	return result, nil
+}
+
+// changedSessions loads the sessions whose stored revision differs from
+// the one last seen here, skipping sessions in local or removed, which the
+// caller is about to write.
+func (st *sessionStore) changedSessions(q queryer, stored map[string]int64, local map[string]bool, removed []string) (map[string]storedSession, error) {
+	skip := make(map[string]bool, len(local)+len(removed))
+	for id := range local {
+		skip[id] = true
+	}
+	for _, id := range removed {
+		skip[id] = true
+	}
+	changed := map[string]storedSession{}
+	for id, revision := range stored {
+		if prev, known := st.written[id]; skip[id] || (known && prev.revision == revision) {
+			continue
+		}
+		session, rec, err := loadSession(q, id)
+		if err != nil {
+			return nil, err
+		}
+		changed[id] = storedSession{session: session, rec: rec}
+	}
+	for id := range st.written {
+		if _, ok := stored[id]; !ok && !skip[id] {
+			changed[id] = storedSession{}
+		}
+	}
+	return changed, nil
+}
+
+// accept records that a session read back from the store is now the local
+// copy, or that a removed session is gone.
+func (st *sessionStore) accept(id string, stored storedSession) {
+	if stored.session == nil {
+		delete(st.written, id)
+		return
+	}
+	st.written[id] = stored.rec
+}
+
+// storedRevisions returns the revision of every stored session.
+func storedRevisions(q queryer) (map[string]int64, error) {
+	rows, err := q.Query(`SELECT session_id, revision FROM sessions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var id string
+		var revision int64
+		if err := rows.Scan(&id, &revision); err != nil {
+			return nil, err
+		}
+		out[id] = revision
+	}
+	return out, rows.Err()
+}
+
+// storedRevision returns the revision of one stored session.
+func (st *sessionStore) storedRevision(id string) (int64, bool, error) {
+	var revision int64
+	err := st.db.QueryRow(`SELECT revision FROM sessions WHERE session_id=?`, id).Scan(&revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return revision, err == nil, err
+}
+
+func writeSessionList(tx *sql.Tx, list sessionList, sessionID string, from int, rows [][]any) error {
+	if _, err := tx.Exec(list.delete, sessionID, from); err != nil {
+		return err
+	}
+	for seq := from; seq < len(rows); seq++ {
+		args := append([]any{sessionID, seq}, rows[seq]...)
+		if _, err := tx.Exec(list.insert, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteSessionRows(tx *sql.Tx, sessionID string) error {
+	for _, stmt := range []string{
+		`DELETE FROM sessions WHERE session_id=?`,
+		`DELETE FROM session_step_history WHERE session_id=?`,
+		`DELETE FROM session_command_results WHERE session_id=?`,
+		`DELETE FROM session_feedback WHERE session_id=?`,
+		`DELETE FROM session_snapshots WHERE session_id=?`,
+		`DELETE FROM work_item_leases WHERE session_id=?`,
+		`DELETE FROM session_plan_versions WHERE session_id=?`,
+	} {
+		if _, err := tx.Exec(stmt, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAll reads every stored session and primes the write cache.
+func (st *sessionStore) loadAll() (map[string]*SessionState, error) {
+	stored, err := storedRevisions(st.db)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]*SessionState, len(stored))
+	for id := range stored {
+		session, rec, err := loadSession(st.db, id)
+		if err != nil {
+			return nil, err
+		}
+		st.written[id] = rec
+		sessions[id] = session
+	}
+	return sessions, nil
+}
+
+// load reads the stored copy of one session in a single transaction, so it
+// never mixes rows of two writes.
+func (st *sessionStore) load(id string) (*SessionState, error) {
+	tx, err := beginTx(st.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	session, _, err := loadSession(tx, id)
+	return session, err
+}
+
+// loadSession reads one stored session together with its record.
+func loadSession(q queryer, id string) (*SessionState, sessionRecord, error) {
+	var base string
+	var revision int64
+	if err := q.QueryRow(`SELECT state_json, revision FROM sessions WHERE session_id=?`, id).Scan(&base, &revision); err != nil {
+		return nil, sessionRecord{}, fmt.Errorf("session %s: %w", id, err)
+	}
+	session := &SessionState{}
+	if err := json.Unmarshal([]byte(base), session); err != nil {
+		return nil, sessionRecord{}, fmt.Errorf("session %s: %w", id, err)
+	}
+	session.SessionID = id
+	for _, list := range sessionLists {
+		if err := loadList(q, session, list); err != nil {
+			return nil, sessionRecord{}, fmt.Errorf("session %s %s: %w", id, list.name, err)
+		}
+	}
+	// The record keeps the stored form, so an upgraded session is written
+	// back on the next save.
+	rec, err := encodeSessionRecord(session)
+	if err != nil {
+		return nil, sessionRecord{}, err
+	}
+	rec.revision = revision
+	if err := upgradeSession(session); err != nil {
+		return nil, sessionRecord{}, err
+	}
+	return session, rec, nil
+}
+
+func loadList(q queryer, session *SessionState, list sessionList) error {
+	rows, err := q.Query(list.query, session.SessionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := list.decode(session, rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// importLegacyFile copies sessions from a sessions.json file written by
+// earlier versions, then renames the file so the import happens once.
+// Sessions already in the database are kept as they are.
+func (st *sessionStore) importLegacyFile(path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	legacy := map[string]*SessionState{}
+	if err := json.Unmarshal(raw, &legacy); err != nil {
+		quarantined, qerr := quarantineFile(path)
+		if qerr != nil {
+			return 0, fmt.Errorf("legacy state %s is corrupt (%v) and could not be quarantined: %w", path, err, qerr)
+		}
+		return 0, fmt.Errorf("legacy state %s is corrupt, moved to %s: %w", path, quarantined, err)
+	}
+
+	existing := map[string]bool{}
+	rows, err := st.db.Query(`SELECT session_id FROM sessions`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		existing[id] = true
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	records := []sessionRecord{}
+	for id, session := range legacy {
+		if session == nil || existing[id] {
+			continue
+		}
+		session.SessionID = id
+		rec, err := encodeSessionRecord(session)
+		if err != nil {
+			return 0, err
+		}
+		records = append(records, rec)
+	}
+	if _, err := st.save(records, nil); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(path, path+legacyImportSuffix); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// snapshotSummary describes a snapshot without its captured state.
+type snapshotSummary struct {
+	Index  int       `json:"index"`
+	Step   WorkStep  `json:"step"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+func summarizeSnapshots(session *SessionState) []snapshotSummary {
+	out := make([]snapshotSummary, 0, len(session.Snapshots))
+	for i, snap := range session.Snapshots {
+		out = append(out, snapshotSummary{Index: i, Step: snap.Step, Reason: snap.Reason, At: snap.At})
+	}
+	return out
+}
+
+// stepTransitions returns how often a session has changed step in this
+// process, or -1 when it does not exist yet.
+func (s *MCPServer) stepTransitions(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return -1
+	}
+	return session.transitions
+}
+
+// snapshotOnTransition captures a snapshot when the tool call that just
+// ran changed the session's step. The caller holds the session lock.
+func (s *MCPServer) snapshotOnTransition(id, reason string, before int) {
+	if id == "" {
+		return
+	}
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok || session.transitions == before || session.transitions == 0 {
+		return
+	}
+	if err := s.captureSnapshot(session, reason); err != nil {
+		s.logger.Warn("capturing session snapshot failed", "session_id", id, "error", err)
+	}
+}
+
+// captureSnapshot appends the session's current state and council rows to
+// its snapshots. The caller holds the session lock.
+func (s *MCPServer) captureSnapshot(session *SessionState, reason string) error {
+	state, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	council := json.RawMessage(`{}`)
+	if s.council != nil {
+		if council, err = s.council.sessionRows(session.SessionID); err != nil {
+			return err
+		}
+	}
+	session.Snapshots = append(session.Snapshots, SessionSnapshot{
+		Step:    session.Step,
+		Reason:  reason,
+		State:   state,
+		Council: council,
+		At:      time.Now().UTC(),
+	})
+	return nil
+}
+
+// rewindSession restores a session and its council rows to a snapshot and
+// drops its work item leases. The step history keeps everything that
+// happened and gains the step rewound to, and the snapshots are kept so the
+// rewind can itself be undone. The caller holds the session lock.
+func (s *MCPServer) rewindSession(session *SessionState, snap SessionSnapshot) error {
+	restored := &SessionState{}
+	if err := json.Unmarshal(snap.State, restored); err != nil {
+		return err
+	}
+	if err := upgradeSession(restored); err != nil {
+		return err
+	}
+	if s.council != nil {
+		if err := s.council.restoreSessionRows(session.SessionID, snap.Council); err != nil {
+			return err
+		}
+		// Leases belong to the work items being replaced.
+		if err := s.council.releaseSessionLeases(session.SessionID); err != nil {
+			return err
+		}
+	}
+	restored.SessionID = session.SessionID
+	restored.StepHistory = append(append([]WorkStep{}, session.StepHistory...), restored.Step)
+	restored.Snapshots = session.Snapshots
+	restored.transitions = session.transitions + 1
+	restored.UpdatedAt = time.Now().UTC()
+	*session = *restored
+	return nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// stateLockSuffix names the advisory lock file next to the database.
+	stateLockSuffix = ".lock"
+	// stateLockTimeout bounds how long a process waits for another
+	// process to finish reloading and writing shared state.
+	stateLockTimeout = 30 * time.Second
+	// busyRetries is how often a write is retried after SQLite's own busy
+	// timeout has run out.
+	busyRetries = 5
+)
+
+// stateFileLock is an advisory lock shared by every process that uses the
+// same state directory. It is held while a process reloads and writes
+// sessions, imports legacy state or replaces the database.
+type stateFileLock struct {
+	path    string
+	timeout time.Duration
+}
+
+func newStateFileLock(dbPath string) *stateFileLock {
+	return &stateFileLock{path: dbPath + stateLockSuffix, timeout: stateLockTimeout}
+}
+
+// lock waits for the advisory lock and returns the function releasing it.
+func (l *stateFileLock) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(l.timeout)
+	delay := 5 * time.Millisecond
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if locked {
+			return func() {
+				_ = unlockFile(f)
+				_ = f.Close()
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			_ = f.Close()
+			return nil, fmt.Errorf("state lock %s is held by another process after %s", l.path, l.timeout)
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, 200*time.Millisecond)
+	}
+}
+
+// isBusy reports whether SQLite refused a statement because another
+// connection or process holds a conflicting lock.
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+// retryBusy runs op again with backoff while it fails with a busy error.
+func retryBusy(op func() error) error {
+	delay := 50 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || !isBusy(err) || attempt == busyRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// beginTx starts a write transaction, retrying while the database is busy.
+func beginTx(db *sql.DB) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retryBusy(func() error {
+		var err error
+		tx, err = db.Begin()
+		return err
+	})
+	return tx, err
+}
+
+// execRetry runs a single write statement, retrying while the database is
+// busy.
+func execRetry(db *sql.DB, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := retryBusy(func() error {
+		var err error
+		res, err = db.Exec(query, args...)
+		return err
+	})
+	return res, err
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// stateBackupKeep is how many timestamped database backups are kept.
+	stateBackupKeep = 5
+	// stateBackupInterval throttles backups taken on write.
+	stateBackupInterval = 10 * time.Minute
+	// stateBackupSuffix ends every backup file name.
+	stateBackupSuffix = ".bak"
+	// quarantineMarker separates a corrupt file's name from its timestamp.
+	quarantineMarker = ".corrupt-"
+	// stateTimestampLayout sorts lexically in time order.
+	stateTimestampLayout = "20060102T150405.000000000Z"
+)
+
+// StateBackup describes a database backup or a quarantined state file.
+type StateBackup struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Kind      string    `json:"kind"` // backup or quarantined
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func stateBackupDir(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), "backups")
+}
+
+func stateTimestamp() string {
+	return time.Now().UTC().Format(stateTimestampLayout)
+}
+
+var errCorruptDatabase = errors.New("database integrity check failed")
+
+// isCorruptDatabase reports errors SQLite raises for a damaged or foreign
+// database file.
+func isCorruptDatabase(err error) bool {
+	if errors.Is(err, errCorruptDatabase) {
+		return true
+	}
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+		return true
+	}
+	return false
+}
+
+// quarantineFile moves a corrupt file aside under a timestamped name so it is
+// never overwritten, and returns the new path.
+func quarantineFile(path string) (string, error) {
+	target := path + quarantineMarker + stateTimestamp()
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// quarantineDatabase moves a corrupt database and its WAL files aside.
+func quarantineDatabase(path string) (string, error) {
+	target, err := quarantineFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			_ = os.Rename(path+suffix, target+suffix)
+		}
+	}
+	return target, nil
+}
+
+// checkDatabaseIntegrity runs SQLite's quick check on an open database.
+func checkDatabaseIntegrity(db *sql.DB) error {
+	var result string
+	if err := db.QueryRow(`PRAGMA quick_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", errCorruptDatabase, result)
+	}
+	return nil
+}
+
+// openStateStores opens the council database and the session store inside
+// it. A corrupt database is quarantined and replaced with an empty one so
+// the server starts without overwriting what is left of the old file. The
+// state file lock keeps other processes from opening it halfway through.
+func openStateStores(path string, logger *slog.Logger) (*councilStore, *sessionStore, error) {
+	lock := newStateFileLock(path)
+	unlock, err := lock.lock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	council, sessions, err := openStateStoresOnce(path)
+	if err != nil && isCorruptDatabase(err) {
+		quarantined, qerr := quarantineDatabase(path)
+		if qerr != nil {
+			return nil, nil, fmt.Errorf("%w (quarantine failed: %v)", err, qerr)
+		}
+		logger.Error("corrupt state database quarantined; run `codex-mcp state recover` to restore a backup", "path", path, "quarantined", quarantined, "error", err)
+		council, sessions, err = openStateStoresOnce(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sessions.lock = lock
+	return council, sessions, nil
+}
+
+func openStateStoresOnce(path string) (*councilStore, *sessionStore, error) {
+	council, err := newCouncilStore(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkDatabaseIntegrity(council.db); err != nil {
+		_ = council.db.Close()
+		return nil, nil, err
+	}
+	return council, newSessionStore(council.db), nil
+}
+
+// backupState writes a consistent copy of the database into the backup
+// directory and drops the oldest backups beyond stateBackupKeep.
+func backupState(db *sql.DB, dbPath string) (string, error) {
+	dir := stateBackupDir(dbPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(dbPath)+"."+stateTimestamp()+stateBackupSuffix)
+	if _, err := db.Exec(`VACUUM INTO ?`, target); err != nil {
+		return "", err
+	}
+	backups, err := listBackupFiles(dbPath)
+	if err != nil {
+		return target, err
+	}
+	for i := 0; i < len(backups)-stateBackupKeep; i++ {
+		_ = os.Remove(backups[i].Path)
+	}
+	return target, nil
+}
+
+// maybeBackupState takes a backup when the last one is older than
+// stateBackupInterval. The caller holds persistMu.
+func (s *MCPServer) maybeBackupState() {
+	if s.council == nil || time.Since(s.lastBackup) < stateBackupInterval {
+		return
+	}
+	s.lastBackup = time.Now()
+	if _, err := backupState(s.council.db, s.cfg.DiscussionDBPath); err != nil {
+		s.logger.Warn("state backup failed", "error", err)
+	}
+}
+
+// listBackupFiles returns the backups of dbPath, oldest first.
+func listBackupFiles(dbPath string) ([]StateBackup, error) {
+	prefix := filepath.Base(dbPath) + "."
+	entries, err := os.ReadDir(stateBackupDir(dbPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := []StateBackup{}
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, stateBackupSuffix)
+		if !ok {
+			continue
+		}
+		out = append(out, stateFileInfo(filepath.Join(stateBackupDir(dbPath), name), "backup", stamp))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// listQuarantinedFiles returns corrupt files moved aside next to path.
+func listQuarantinedFiles(path string) ([]StateBackup, error) {
+	matches, err := filepath.Glob(path + quarantineMarker + "*")
+	if err != nil {
+		return nil, err
+	}
+	out := []StateBackup{}
+	for _, match := range matches {
+		stamp := strings.TrimPrefix(match, path+quarantineMarker)
+		if strings.HasSuffix(stamp, "-wal") || strings.HasSuffix(stamp, "-shm") {
+			continue
+		}
+		out = append(out, stateFileInfo(match, "quarantined", stamp))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func stateFileInfo(path, kind, stamp string) StateBackup {
+	backup := StateBackup{Name: filepath.Base(path), Path: path, Kind: kind}
+	if at, err := time.Parse(stateTimestampLayout, stamp); err == nil {
+		backup.CreatedAt = at
+	}
+	if info, err := os.Stat(path); err == nil {
+		backup.SizeBytes = info.Size()
+	}
+	return backup
+}
+
+// ListStateBackups lists database backups and quarantined state files for
+// the given configuration, oldest first.
+func ListStateBackups(cfg Config) ([]StateBackup, error) {
+	cfg = withStateDefaults(cfg)
+	backups, err := listBackupFiles(cfg.DiscussionDBPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range []string{cfg.DiscussionDBPath, cfg.StatePath} {
+		quarantined, err := listQuarantinedFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, quarantined...)
+	}
+	return backups, nil
+}
+
+// RestoreStateBackup replaces the database contents with the named backup.
+// The current contents are backed up first, so a restore can be undone.
+func RestoreStateBackup(cfg Config, name string) (string, error) {
+	cfg = withStateDefaults(cfg)
+	council, sessions, err := openStateStores(cfg.DiscussionDBPath, cfg.Logger)
+	if err != nil {
+		return "", err
+	}
+	defer council.db.Close()
+	unlock, err := sessions.lockState()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	return restoreStateBackup(council.db, cfg.DiscussionDBPath, name)
+}
+
+// restoreStateBackup copies every table of a backup over the live database
+// in one transaction, so other connections never see a partial restore.
+// Backups taken at an older schema version restore into the current one.
+func restoreStateBackup(db *sql.DB, dbPath, name string) (string, error) {
+	backups, err := listBackupFiles(dbPath)
+	if err != nil {
+		return "", err
+	}
+	var source string
+	for _, backup := range backups {
+		if backup.Name == name {
+			source = backup.Path
+		}
+	}
+	if source == "" {
+		return "", fmt.Errorf("unknown backup %q; list backups with `codex-mcp state recover`", name)
+	}
+	safety, err := backupState(db, dbPath)
+	if err != nil {
+		return "", fmt.Errorf("backing up current state before restore: %w", err)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS backup`, source); err != nil {
+		return "", err
+	}
+	defer conn.ExecContext(ctx, `DETACH DATABASE backup`)
+
+	var backupVersion int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM backup.schema_migrations`).Scan(&backupVersion); err == nil && backupVersion > latestSchemaVersion() {
+		return "", fmt.Errorf("%w: backup %s has schema version %d, supported up to %d", ErrSchemaTooNew, name, backupVersion, latestSchemaVersion())
+	}
+	tables, err := schemaTables(ctx, conn, "main")
+	if err != nil {
+		return "", err
+	}
+	inBackup, err := schemaTables(ctx, conn, "backup")
+	if err != nil {
+		return "", err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	// The live schema is kept: schema_migrations is not copied, tables the
+	// backup lacks are emptied, and rows are copied by the columns both
+	// sides share, so a backup from an older schema takes the defaults of
+	// columns added since.
+	for _, table := range tables {
+		if table == "schema_migrations" {
+			continue
+		}
+		quoted := quoteIdent(table)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM main.`+quoted); err != nil {
+			_ = tx.Rollback()
+			return "", err
+		}
+		if !containsString(inBackup, table) {
+			continue
+		}
+		columns, err := sharedColumns(ctx, tx, table)
+		if err != nil {
+			_ = tx.Rollback()
+			return "", err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		list := strings.Join(columns, ", ")
+		if _, err := tx.ExecContext(ctx, `INSERT INTO main.`+quoted+` (`+list+`) SELECT `+list+` FROM backup.`+quoted); err != nil {
+			_ = tx.Rollback()
+			return "", fmt.Errorf("restoring %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return safety, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// schemaTables lists the tables of an attached schema ("main" or "backup").
+func schemaTables(ctx context.Context, conn *sql.Conn, schema string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT name FROM `+schema+`.sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// sharedColumns returns the quoted columns a table has both in the live
+// database and in the backup, in live order.
+func sharedColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?, 'main') WHERE name IN (SELECT name FROM pragma_table_info(?, 'backup')) ORDER BY cid`, table, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, quoteIdent(name))
+	}
+	return columns, rows.Err()
+}
+
+// restoreState restores a backup into the running server and reloads its
+// sessions from the restored rows.
+func (s *MCPServer) restoreState(name string) (string, error) {
+	if s.council == nil || s.store == nil {
+		return "", errSessionStoreUnavailable
+	}
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	unlock, err := s.store.lockState()
+	if err != nil {
+		return "", err
+	}
+	safety, err := restoreStateBackup(s.council.db, s.cfg.DiscussionDBPath, name)
+	unlock()
+	if err != nil {
+		return "", err
+	}
+	s.store.written = map[string]sessionRecord{}
+	if err := s.loadSessions(); err != nil {
+		return safety, err
+	}
+	return safety, nil
+}
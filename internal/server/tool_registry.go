@@ -0,0 +1,347 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// toolHandler runs one tool call. ctx carries cancellation and progress.
+type toolHandler func(s *MCPServer, ctx context.Context, raw json.RawMessage) (any, error)
+
+// toolAnnotations are the MCP behaviour hints published with each tool.
+type toolAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`
+	DestructiveHint bool `json:"destructiveHint"`
+	IdempotentHint  bool `json:"idempotentHint"`
+	OpenWorldHint   bool `json:"openWorldHint"`
+}
+
+var (
+	// readOnlyTool only reports state.
+	readOnlyTool = toolAnnotations{ReadOnlyHint: true, IdempotentHint: true}
+	// workflowTool updates session or council state and nothing else.
+	workflowTool = toolAnnotations{}
+	// commandTool runs commands or git operations against the workspace.
+	commandTool = toolAnnotations{DestructiveHint: true, OpenWorldHint: true}
+	// stateTool can replace persisted server state wholesale.
+	stateTool = toolAnnotations{DestructiveHint: true}
+)
+
+type toolSchema struct {
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	InputSchema  map[string]any  `json:"inputSchema"`
+	OutputSchema map[string]any  `json:"outputSchema"`
+	Annotations  toolAnnotations `json:"annotations"`
+}
+
+type toolDefinition struct {
+	toolSchema
+	handler toolHandler
+}
+
+func newTool(name, description string, annotations toolAnnotations, handler toolHandler, input, output map[string]any) toolDefinition {
+	return toolDefinition{
+		toolSchema: toolSchema{
+			Name:         name,
+			Description:  description,
+			InputSchema:  input,
+			OutputSchema: output,
+			Annotations:  annotations,
+		},
+		handler: handler,
+	}
+}
+
+// outputSchema builds a tool's outputSchema from field name to JSON type.
+// A "|null" suffix marks fields that may be null. The toolFailure fields are
+// always included so isError results match the same schema.
+func outputSchema(fields map[string]string) map[string]any {
+	props := map[string]any{}
+	for name, typ := range toolFailureFields {
+		props[name] = map[string]any{"type": typ}
+	}
+	for name, typ := range fields {
+		if base, ok := strings.CutSuffix(typ, "|null"); ok {
+			props[name] = map[string]any{"type": []string{base, "null"}}
+			continue
+		}
+		props[name] = map[string]any{"type": typ}
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+var toolFailureFields = map[string]string{
+	"session_id":    "string",
+	"step":          "string",
+	"expected_step": "string",
+	"next_step":     "string",
+	"reason":        "string",
+}
+
+// toolFailure is a tool-level refusal or failure. Unlike protocol errors it
+// is returned as a tools/call result with isError set, so clients can tell
+// workflow gates apart from malformed requests.
+type toolFailure struct {
+	SessionID    string   `json:"session_id,omitempty"`
+	Step         WorkStep `json:"step,omitempty"`
+	ExpectedStep string   `json:"expected_step,omitempty"`
+	NextStep     string   `json:"next_step,omitempty"`
+	Reason       string   `json:"reason"`
+}
+
+func (f *toolFailure) Error() string {
+	return f.Reason
+}
+
+// stepGateError reports a tool called outside the steps it accepts.
+func stepGateError(session *SessionState, reason string, expected ...WorkStep) *toolFailure {
+	steps := make([]string, 0, len(expected))
+	for _, step := range expected {
+		steps = append(steps, string(step))
+	}
+	return &toolFailure{
+		SessionID:    session.SessionID,
+		Step:         session.Step,
+		ExpectedStep: strings.Join(steps, "|"),
+		NextStep:     nextAction(session),
+		Reason:       reason,
+	}
+}
+
+// toolFailureFor converts a handler error into a toolFailure, filling in the
+// session position when the handler did not. The caller holds the session lock.
+func (s *MCPServer) toolFailureFor(call toolCallRequest, err error) *toolFailure {
+	var failure *toolFailure
+	if !errors.As(err, &failure) {
+		failure = &toolFailure{Reason: err.Error()}
+	}
+	if failure.SessionID != "" || !isSessionScopedTool(call.Name) {
+		return failure
+	}
+	id := toolArgsSessionID(call.Arguments)
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if ok {
+		failure.SessionID = session.SessionID
+		failure.Step = session.Step
+		if failure.NextStep == "" {
+			failure.NextStep = nextAction(session)
+		}
+	}
+	return failure
+}
+
+// contextFree adapts handlers that do not observe cancellation.
+func contextFree(fn func(*MCPServer, json.RawMessage) (any, error)) toolHandler {
+	return func(s *MCPServer, _ context.Context, raw json.RawMessage) (any, error) {
+		return fn(s, raw)
+	}
+}
+
+var toolRegistry = sync.OnceValue(func() map[string]toolDefinition {
+	out := map[string]toolDefinition{}
+	for _, tool := range toolDefinitions() {
+		if _, dup := out[tool.Name]; dup {
+			panic("duplicate tool definition: " + tool.Name)
+		}
+		out[tool.Name] = tool
+	}
+	return out
+})
+
+func lookupTool(name string) (toolDefinition, bool) {
+	tool, ok := toolRegistry()[name]
+	return tool, ok
+}
+
+func toolListResponse() map[string]any {
+	defs := toolDefinitions()
+	tools := make([]toolSchema, 0, len(defs))
+	for _, tool := range defs {
+		tools = append(tools, tool.toolSchema)
+	}
+	return map[string]any{"tools": tools}
+}
+
+var errUnknownTool = errors.New("unknown tool")
+
+// toolArgumentError reports the first argument that does not match a tool's
+// input schema. It is returned to clients as JSON-RPC -32602.
+type toolArgumentError struct {
+	Field   string
+	Problem string
+}
+
+func (e *toolArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument %q: %s", e.Field, e.Problem)
+}
+
+// validateToolArguments checks raw arguments against the subset of JSON
+// Schema used by the tool definitions: type, properties, required, items,
+// enum and additionalProperties. Objects that declare properties reject
+// unknown fields unless additionalProperties says otherwise.
+func validateToolArguments(schema map[string]any, raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		raw = []byte("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return &toolArgumentError{Field: "arguments", Problem: "must be a JSON object"}
+	}
+	return validateSchemaValue(schema, value, "")
+}
+
+func validateSchemaValue(schema map[string]any, value any, path string) error {
+	field := path
+	if field == "" {
+		field = "arguments"
+	}
+	switch typ := schema["type"].(type) {
+	case string:
+		if !matchesSchemaType(typ, value) {
+			return &toolArgumentError{Field: field, Problem: "must be " + schemaTypeNoun(typ)}
+		}
+	case []string:
+		matched := false
+		nouns := make([]string, 0, len(typ))
+		for _, t := range typ {
+			matched = matched || matchesSchemaType(t, value)
+			nouns = append(nouns, schemaTypeNoun(t))
+		}
+		if !matched {
+			return &toolArgumentError{Field: field, Problem: "must be " + strings.Join(nouns, " or ")}
+		}
+	}
+	if enum, ok := schema["enum"].([]string); ok {
+		str, _ := value.(string)
+		if !containsString(enum, str) {
+			return &toolArgumentError{Field: field, Problem: "must be one of " + strings.Join(enum, ", ")}
+		}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		return validateSchemaObject(schema, v, path)
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		for i, item := range v {
+			if err := validateSchemaValue(items, item, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSchemaObject(schema map[string]any, obj map[string]any, path string) error {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	required, _ := schema["required"].([]string)
+	for _, key := range required {
+		if v, ok := obj[key]; !ok || v == nil {
+			return &toolArgumentError{Field: join(key), Problem: "is required"}
+		}
+	}
+	props, hasProps := schema["properties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"].(map[string]any)
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := obj[key]
+		if propSchema, ok := props[key].(map[string]any); ok {
+			if v == nil {
+				// Explicit null reads as an omitted optional field.
+				continue
+			}
+			if err := validateSchemaValue(propSchema, v, join(key)); err != nil {
+				return err
+			}
+			continue
+		}
+		switch {
+		case hasAdditional:
+			if err := validateSchemaValue(additional, v, join(key)); err != nil {
+				return err
+			}
+		case hasProps:
+			return &toolArgumentError{Field: join(key), Problem: "is not a known field"}
+		}
+	}
+	return nil
+}
+
+func matchesSchemaType(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "null":
+		return value == nil
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	default:
+		return true
+	}
+}
+
+func schemaTypeNoun(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	case "null":
+		return "null"
+	default:
+		return "a " + typ
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,9 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os/exec"
 	"path/filepath"
@@ -15,637 +17,1411 @@ import (
 	"unicode"
 )
 
-type toolSchema struct {
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	InputSchema map[string]any `json:"inputSchema"`
-}
-
-func toolListResponse() map[string]any {
-	return map[string]any{
-		"tools": []toolSchema{
-			newTool(
-				"start_interview",
-				"Workflow entrypoint. Initialize session and generate interview questions",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"raw_intent": map[string]any{"type": "string"},
-						"user_profile": map[string]any{
-							"type": "object",
-							"properties": map[string]any{
-								"overall":         map[string]any{"type": "string", "description": "unknown|beginner|intermediate|advanced"},
-								"response_need":   map[string]any{"type": "string", "description": "low|balanced|high"},
-								"technical_depth": map[string]any{"type": "string", "description": "abstract|balanced|technical"},
-								"consultant_lang": map[string]any{"type": "string", "description": "ko|en"},
-								"domain_knowledge": map[string]any{
-									"type":                 "object",
-									"additionalProperties": map[string]any{"type": "string"},
-								},
+// toolDefinitions declares every tool once: name, description,
+// annotations, handler, input schema and output schema.
+func toolDefinitions() []toolDefinition {
+	return []toolDefinition{
+		newTool(
+			"start_interview",
+			"Workflow entrypoint. Initialize session and generate interview questions",
+			workflowTool,
+			contextFree((*MCPServer).toolStartInterview),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"raw_intent": map[string]any{"type": "string"},
+					"user_profile": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"overall":         map[string]any{"type": "string", "description": "unknown|beginner|intermediate|advanced"},
+							"response_need":   map[string]any{"type": "string", "description": "low|balanced|high"},
+							"technical_depth": map[string]any{"type": "string", "description": "abstract|balanced|technical"},
+							"consultant_lang": map[string]any{"type": "string", "description": "ko|en"},
+							"domain_knowledge": map[string]any{
+								"type":                 "object",
+								"additionalProperties": map[string]any{"type": "string"},
 							},
 						},
-						"available_mcps": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "List of available MCP server names in current runtime",
-						},
-						"available_mcp_tools": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "List of available MCP tool names in current runtime",
-						},
+					},
+					"available_mcps": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "List of available MCP server names in current runtime",
+					},
+					"available_mcp_tools": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "List of available MCP tool names in current runtime",
 					},
 				},
-			),
-			newTool(
-				"ingest_intent",
-				"Collect raw user requirement text and normalize into base intent structure",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"raw_intent": map[string]any{"type": "string", "description": "Raw user request text"},
-						"session_id": map[string]any{"type": "string"},
-						"user_profile": map[string]any{
-							"type": "object",
-							"properties": map[string]any{
-								"overall":         map[string]any{"type": "string"},
-								"response_need":   map[string]any{"type": "string"},
-								"technical_depth": map[string]any{"type": "string"},
-								"consultant_lang": map[string]any{"type": "string"},
-								"domain_knowledge": map[string]any{
-									"type":                 "object",
-									"additionalProperties": map[string]any{"type": "string"},
-								},
+			},
+			outputSchema(map[string]string{
+				"auto_decidable":       "array|null",
+				"autostart_mode":       "string",
+				"autostart_session_id": "string",
+				"available_mcp_tools":  "array|null",
+				"available_mcps":       "array|null",
+				"baseline_footprint":   "object",
+				"consultant_lang":      "string",
+				"current_footprint":    "object",
+				"drift_level":          "string",
+				"drift_reason":         "string",
+				"entrypoint":           "string",
+				"interview_questions":  "array|null",
+				"must_confirm_topics":  "array|null",
+				"next_step":            "string",
+				"pending_review":       "array|null",
+				"proposal_accepted":    "boolean",
+				"proposal_history":     "array|null",
+				"question_topic":       "string",
+				"resume":               "boolean",
+				"session_id":           "string",
+				"step":                 "string",
+				"user_profile":         "object",
+				"visual_review":        "object",
+			}),
+		),
+		newTool(
+			"ingest_intent",
+			"Collect raw user requirement text and normalize into base intent structure",
+			workflowTool,
+			contextFree((*MCPServer).toolIngestIntent),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"raw_intent": map[string]any{"type": "string", "description": "Raw user request text"},
+					"session_id": map[string]any{"type": "string"},
+					"user_profile": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"overall":         map[string]any{"type": "string"},
+							"response_need":   map[string]any{"type": "string"},
+							"technical_depth": map[string]any{"type": "string"},
+							"consultant_lang": map[string]any{"type": "string"},
+							"domain_knowledge": map[string]any{
+								"type":                 "object",
+								"additionalProperties": map[string]any{"type": "string"},
 							},
 						},
-						"available_mcps": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "List of available MCP server names in current runtime",
-						},
-						"available_mcp_tools": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "List of available MCP tool names in current runtime",
-						},
 					},
-					"required": []string{"raw_intent"},
-				},
-			),
-			newTool(
-				"clarify_intent",
-				"Fill missing intent fields and run consultant outline loop (one focused question per turn)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"answers": map[string]any{
-							"type":        "object",
-							"description": "Examples: goal/scope/constraints/success_criteria + proposal_feedback + knowledge_level/response_need/technical_depth/domain_knowledge",
-						},
+					"available_mcps": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "List of available MCP server names in current runtime",
 					},
-					"required": []string{"session_id"},
-				},
-			),
-			newTool(
-				"generate_plan",
-				"Generate executable plan from clarified requirements",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
+					"available_mcp_tools": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "List of available MCP tool names in current runtime",
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"generate_mockup",
-				"Generate quick mockup (text prototype) from current intent/plan",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
+				"required": []string{"raw_intent"},
+			},
+			outputSchema(map[string]string{
+				"auto_assumptions":     "array|null",
+				"auto_decidable":       "array|null",
+				"autostart_mode":       "string",
+				"autostart_session_id": "string",
+				"available_mcp_tools":  "array|null",
+				"available_mcps":       "array|null",
+				"consultant_lang":      "string",
+				"intent":               "object",
+				"must_confirm_topics":  "array|null",
+				"next_step":            "string",
+				"pending_review":       "array|null",
+				"proposal_accepted":    "boolean",
+				"proposal_history":     "array|null",
+				"question_reason":      "string",
+				"question_topic":       "string",
+				"session_id":           "string",
+				"step":                 "string",
+				"user_profile":         "object",
+			}),
+		),
+		newTool(
+			"clarify_intent",
+			"Fill missing intent fields and run consultant outline loop (one focused question per turn)",
+			workflowTool,
+			(*MCPServer).toolClarifyIntentContext,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"answers": map[string]any{
+						"type":        "object",
+						"description": "Examples: goal/scope/constraints/success_criteria + proposal_feedback + knowledge_level/response_need/technical_depth/domain_knowledge",
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"approve_plan",
-				"Approve or reject generated plan",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"approved":   map[string]any{"type": "boolean"},
-						"notes":      map[string]any{"type": "string"},
-						"requirement_tags": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "Requirement tags (e.g., auth, tests, performance)",
-						},
-						"success_criteria": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "Requirement success criteria aligned with intent success_criteria",
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"auto_assumptions":    "array|null",
+				"auto_decidable":      "array|null",
+				"consultant_lang":     "string",
+				"consultant_message":  "string",
+				"current_proposal":    "object|null",
+				"follow_up_questions": "array|null",
+				"intent":              "object",
+				"must_confirm_topics": "array|null",
+				"next_step":           "string",
+				"notes_count":         "number",
+				"pending_review":      "array|null",
+				"proposal_accepted":   "boolean",
+				"proposal_decision":   "string",
+				"proposal_history":    "array|null",
+				"question_reason":     "string",
+				"question_topic":      "string",
+				"session_id":          "string",
+				"status":              "string",
+				"step":                "string",
+				"user_profile":        "object",
+			}),
+		),
+		newTool(
+			"generate_plan",
+			"Generate executable plan from clarified requirements",
+			workflowTool,
+			contextFree((*MCPServer).toolGeneratePlan),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"items": map[string]any{
+						"type":        "array",
+						"description": "Work items; omit for a single item covering the goal",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"id":               map[string]any{"type": "string"},
+								"title":            map[string]any{"type": "string"},
+								"owner":            map[string]any{"type": "string", "description": "Council manager of the session or a *_worker role"},
+								"files":            map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Glob patterns of files to change"},
+								"verify":           map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Allowed commands that verify the item"},
+								"requirement_tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+								"criteria":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Success criteria the item delivers"},
+								"depends_on":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "IDs of items to finish first"},
+							},
+							"required": []string{"id", "title", "owner"},
 						},
 					},
-					"required": []string{"session_id", "approved"},
 				},
-			),
-			newTool(
-				"reconcile_session_state",
-				"Reconcile persisted session state with current repo state (git + footprint)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"mode": map[string]any{
-							"type": "string",
-							"enum": []string{"check", "keep_context", "restart_context"},
-						},
-					},
-					"required": []string{"session_id"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"next_step":    "string",
+				"order":        "array",
+				"plan":         "object",
+				"plan_version": "number",
+				"session_id":   "string",
+				"step":         "string",
+			}),
+		),
+		newTool(
+			"generate_mockup",
+			"Generate quick mockup (text prototype) from current intent/plan",
+			workflowTool,
+			contextFree((*MCPServer).toolGenerateMockup),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"set_agent_routing_policy",
-				"Set role-based model routing policy",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id":             map[string]any{"type": "string"},
-						"client_interview_model": map[string]any{"type": "string"},
-						"orchestrator_model":     map[string]any{"type": "string"},
-						"reviewer_model":         map[string]any{"type": "string"},
-						"worker_model":           map[string]any{"type": "string"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"mockup":     "object",
+				"next_step":  "string",
+				"session_id": "string",
+				"step":       "string",
+			}),
+		),
+		newTool(
+			"approve_plan",
+			"Approve or reject generated plan; when the client supports elicitation the user is asked directly and `approved` is ignored",
+			workflowTool,
+			(*MCPServer).toolApprovePlanContext,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"approved":   map[string]any{"type": "boolean"},
+					"notes":      map[string]any{"type": "string"},
+					"requirement_tags": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Requirement tags (e.g., auth, tests, performance)",
 					},
-					"required": []string{"session_id"},
+					"success_criteria": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Requirement success criteria aligned with intent success_criteria",
+					},
+					"criteria_checks": criteriaChecksSchema,
 				},
-			),
-			newTool(
-				"get_agent_routing_policy",
-				"Get current role-based model routing policy",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
+				"required": []string{"session_id", "approved"},
+			},
+			outputSchema(map[string]string{
+				"approved":             "boolean",
+				"blocking_reasons":     "array|null",
+				"criterion_checks":     "array|null",
+				"decided_by":           "string",
+				"next_step":            "string",
+				"notes":                "string",
+				"plan_version":         "number",
+				"required_actions":     "array|null",
+				"session_id":           "string",
+				"session_requirements": "object",
+				"step":                 "string",
+			}),
+		),
+		newTool(
+			"diff_plan",
+			"Compare two plan versions: added, removed and changed items, assumptions and risks, and the feedback behind the newer version",
+			readOnlyTool,
+			contextFree((*MCPServer).toolDiffPlan),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"from":       map[string]any{"type": "number", "description": "Older plan version; defaults to the one before `to`"},
+					"to":         map[string]any{"type": "number", "description": "Newer plan version; defaults to the latest"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"approved_plan_version": "number",
+				"assumptions":           "object",
+				"feedback":              "array",
+				"from":                  "number",
+				"items":                 "object",
+				"risks":                 "object",
+				"session_id":            "string",
+				"title":                 "object|null",
+				"to":                    "number",
+				"versions":              "array",
+			}),
+		),
+		newTool(
+			"reconcile_session_state",
+			"Reconcile persisted session state with current repo state (git + footprint)",
+			workflowTool,
+			(*MCPServer).toolReconcileSessionStateContext,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"mode": map[string]any{
+						"type": "string",
+						"enum": []string{"check", "keep_context", "restart_context"},
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"council_configure_team",
-				"Configure manager roster for council (append/replace/remove dynamic roles)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"mode":       map[string]any{"type": "string", "enum": []string{"append", "replace", "remove"}},
-						"managers": map[string]any{
-							"type": "array",
-							"items": map[string]any{
-								"type": "object",
-								"properties": map[string]any{
-									"role":   map[string]any{"type": "string"},
-									"domain": map[string]any{"type": "string"},
-									"model":  map[string]any{"type": "string"},
-								},
-								"required": []string{"role"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"baseline_footprint": "object",
+				"current_footprint":  "object",
+				"decided_by":         "string",
+				"drift_level":        "string",
+				"drift_reason":       "string",
+				"mode":               "string",
+				"next_step":          "string",
+				"options":            "array|null",
+				"pending_review":     "array|null",
+				"reconcile_needed":   "boolean",
+				"session_id":         "string",
+			}),
+		),
+		newTool(
+			"set_agent_routing_policy",
+			"Set role-based model routing policy",
+			workflowTool,
+			contextFree((*MCPServer).toolSetAgentRoutingPolicy),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id":             map[string]any{"type": "string"},
+					"client_interview_model": map[string]any{"type": "string"},
+					"orchestrator_model":     map[string]any{"type": "string"},
+					"reviewer_model":         map[string]any{"type": "string"},
+					"worker_model":           map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"routing_policy": "object",
+				"session_id":     "string",
+			}),
+		),
+		newTool(
+			"get_agent_routing_policy",
+			"Get current role-based model routing policy",
+			readOnlyTool,
+			contextFree((*MCPServer).toolGetAgentRoutingPolicy),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"routing_policy": "object",
+				"session_id":     "string",
+			}),
+		),
+		newTool(
+			"council_configure_team",
+			"Configure manager roster for council (append/replace/remove dynamic roles)",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilConfigureTeam),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"mode":       map[string]any{"type": "string", "enum": []string{"append", "replace", "remove"}},
+					"managers": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"role":   map[string]any{"type": "string"},
+								"domain": map[string]any{"type": "string"},
+								"model":  map[string]any{"type": "string"},
 							},
+							"required": []string{"role"},
 						},
 					},
-					"required": []string{"session_id", "mode", "managers"},
 				},
-			),
-			newTool(
-				"council_start_briefing",
-				"Start manager council parallel briefing round",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"manager_mode": map[string]any{
-							"type": "string",
-							"enum": []string{"append", "replace", "remove"},
-						},
-						"managers": map[string]any{
-							"type": "array",
-							"items": map[string]any{
-								"type": "object",
-								"properties": map[string]any{
-									"role":   map[string]any{"type": "string"},
-									"domain": map[string]any{"type": "string"},
-									"model":  map[string]any{"type": "string"},
-								},
-								"required": []string{"role"},
+				"required": []string{"session_id", "mode", "managers"},
+			},
+			outputSchema(map[string]string{
+				"council_consensus": "boolean",
+				"council_managers":  "array|null",
+				"council_phase":     "string",
+				"mode":              "string",
+				"next_step":         "string",
+				"session_id":        "string",
+			}),
+		),
+		newTool(
+			"council_start_briefing",
+			"Start manager council parallel briefing round",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilStartBriefing),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"manager_mode": map[string]any{
+						"type": "string",
+						"enum": []string{"append", "replace", "remove"},
+					},
+					"managers": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"role":   map[string]any{"type": "string"},
+								"domain": map[string]any{"type": "string"},
+								"model":  map[string]any{"type": "string"},
 							},
+							"required": []string{"role"},
 						},
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"council_submit_brief",
-				"Submit briefing for each manager role (parallel execution result input)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id":      map[string]any{"type": "string"},
-						"role":            map[string]any{"type": "string"},
-						"priority":        map[string]any{"type": "string"},
-						"contribution":    map[string]any{"type": "string"},
-						"quick_decisions": map[string]any{"type": "string"},
-						"topic_proposals": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"brief_prompts":    "array|null",
+				"council_managers": "array|null",
+				"next_step":        "string",
+				"phase":            "string",
+				"roles":            "array|null",
+				"session_id":       "string",
+				"topics":           "array|null",
+				"user_profile":     "object",
+			}),
+		),
+		newTool(
+			"council_submit_brief",
+			"Submit briefing for each manager role (parallel execution result input)",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilSubmitBrief),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id":      map[string]any{"type": "string"},
+					"role":            map[string]any{"type": "string"},
+					"priority":        map[string]any{"type": "string"},
+					"contribution":    map[string]any{"type": "string"},
+					"quick_decisions": map[string]any{"type": "string"},
+					"topic_proposals": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
 					},
-					"required": []string{"session_id", "role", "priority", "contribution"},
 				},
-			),
-			newTool(
-				"council_summarize_briefs",
-				"Moderator summarizes briefings and builds agenda topics",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-					},
-					"required": []string{"session_id"},
+				"required": []string{"session_id", "role", "priority", "contribution"},
+			},
+			outputSchema(map[string]string{
+				"brief_submitted": "number",
+				"brief_total":     "number",
+				"next_step":       "string",
+				"phase":           "string",
+				"session_id":      "string",
+				"submitted_role":  "string",
+			}),
+		),
+		newTool(
+			"council_summarize_briefs",
+			"Moderator summarizes briefings and builds agenda topics",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilSummarizeBriefs),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"council_request_floor",
-				"Manager requests speaking floor (topic_id required)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"topic_id":   map[string]any{"type": "number"},
-						"role":       map[string]any{"type": "string"},
-						"reason":     map[string]any{"type": "string"},
-					},
-					"required": []string{"session_id", "topic_id", "role"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"next_step":  "string",
+				"phase":      "string",
+				"session_id": "string",
+				"summary":    "string",
+				"topics":     "array|null",
+			}),
+		),
+		newTool(
+			"council_request_floor",
+			"Manager requests speaking floor (topic_id required)",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilRequestFloor),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"topic_id":   map[string]any{"type": "number"},
+					"role":       map[string]any{"type": "string"},
+					"reason":     map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"council_grant_floor",
-				"Moderator grants speaking floor",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"request_id": map[string]any{"type": "number"},
-					},
-					"required": []string{"session_id", "request_id"},
+				"required": []string{"session_id", "topic_id", "role"},
+			},
+			outputSchema(map[string]string{
+				"next_step":  "string",
+				"request_id": "number",
+				"session_id": "string",
+				"topic_id":   "number",
+			}),
+		),
+		newTool(
+			"council_grant_floor",
+			"Moderator grants speaking floor",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilGrantFloor),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"request_id": map[string]any{"type": "number"},
 				},
-			),
-			newTool(
-				"council_publish_statement",
-				"Publish floor-granted manager statement and propagate to other roles",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"request_id": map[string]any{"type": "number"},
-						"content":    map[string]any{"type": "string"},
-					},
-					"required": []string{"session_id", "request_id", "content"},
+				"required": []string{"session_id", "request_id"},
+			},
+			outputSchema(map[string]string{
+				"granted_to": "string",
+				"next_step":  "string",
+				"request_id": "number",
+				"session_id": "string",
+				"topic_id":   "number",
+			}),
+		),
+		newTool(
+			"council_publish_statement",
+			"Publish floor-granted manager statement and propagate to other roles",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilPublishStatement),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"request_id": map[string]any{"type": "number"},
+					"content":    map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"council_respond_topic",
-				"Record each manager's pass/raise response per topic",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"topic_id":   map[string]any{"type": "number"},
-						"role":       map[string]any{"type": "string"},
-						"decision":   map[string]any{"type": "string", "enum": []string{"pass", "raise"}},
-						"content":    map[string]any{"type": "string"},
-					},
-					"required": []string{"session_id", "topic_id", "role", "decision"},
+				"required": []string{"session_id", "request_id", "content"},
+			},
+			outputSchema(map[string]string{
+				"next_step":     "string",
+				"session_id":    "string",
+				"topic_id":      "number",
+				"waiting_roles": "array|null",
+			}),
+		),
+		newTool(
+			"council_respond_topic",
+			"Record each manager's pass/raise response per topic",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilRespondTopic),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"topic_id":   map[string]any{"type": "number"},
+					"role":       map[string]any{"type": "string"},
+					"decision":   map[string]any{"type": "string", "enum": []string{"pass", "raise"}},
+					"content":    map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"council_close_topic",
-				"Close topic when all manager roles pass",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"topic_id":   map[string]any{"type": "number"},
-					},
-					"required": []string{"session_id", "topic_id"},
+				"required": []string{"session_id", "topic_id", "role", "decision"},
+			},
+			outputSchema(map[string]string{
+				"closable":      "boolean",
+				"next_step":     "string",
+				"pending_roles": "array|null",
+				"session_id":    "string",
+				"topic_id":      "number",
+			}),
+		),
+		newTool(
+			"council_close_topic",
+			"Close topic when all manager roles pass",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilCloseTopic),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"topic_id":   map[string]any{"type": "number"},
 				},
-			),
-			newTool(
-				"council_finalize_consensus",
-				"Finalize consensus after all topics are closed",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-					},
-					"required": []string{"session_id"},
+				"required": []string{"session_id", "topic_id"},
+			},
+			outputSchema(map[string]string{
+				"next_step":   "string",
+				"open_topics": "number",
+				"session_id":  "string",
+				"topic_id":    "number",
+			}),
+		),
+		newTool(
+			"council_finalize_consensus",
+			"Finalize consensus after all topics are closed",
+			workflowTool,
+			contextFree((*MCPServer).toolCouncilFinalizeConsensus),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"council_get_status",
-				"Get council discussion status/topics/messages",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id":    map[string]any{"type": "string"},
-						"message_limit": map[string]any{"type": "number"},
-					},
-					"required": []string{"session_id"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"council_consensus": "boolean",
+				"next_step":         "string",
+				"phase":             "string",
+				"session_id":        "string",
+			}),
+		),
+		newTool(
+			"council_get_status",
+			"Get council discussion status/topics/messages",
+			readOnlyTool,
+			contextFree((*MCPServer).toolCouncilGetStatus),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id":    map[string]any{"type": "string"},
+					"message_limit": map[string]any{"type": "number"},
 				},
-			),
-			newTool(
-				"validate_workflow_transition",
-				"Validate whether workflow transition is allowed",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id":   map[string]any{"type": "string"},
-						"current_step": map[string]any{"type": "string"},
-						"next_step":    map[string]any{"type": "string"},
-					},
-					"required": []string{"session_id", "current_step", "next_step"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"council_managers": "array|null",
+				"messages":         "array|null",
+				"phase":            "string",
+				"proposals":        "array|null",
+				"roles":            "array|null",
+				"session_id":       "string",
+				"status":           "string",
+				"summary":          "string",
+				"topics":           "array|null",
+			}),
+		),
+		newTool(
+			"validate_workflow_transition",
+			"Validate whether workflow transition is allowed",
+			readOnlyTool,
+			contextFree((*MCPServer).toolValidateTransition),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id":   map[string]any{"type": "string"},
+					"current_step": map[string]any{"type": "string"},
+					"next_step":    map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"run_action",
-				"Run allowlisted commands from approved plan",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"commands": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
-						"executor_role": map[string]any{
-							"type":        "string",
-							"description": "Execution agent role. Must be a worker role (e.g., backend_worker, frontend_worker, implementation_worker).",
-						},
-						"executor_model": map[string]any{
-							"type":        "string",
-							"description": "Model used by execution agent. Must match routing_policy.worker_model.",
-						},
-						"delegated_by": map[string]any{
-							"type":        "string",
-							"description": "Manager/consultant role that delegated this implementation task.",
-						},
-						"dry_run":     map[string]any{"type": "boolean"},
-						"timeout_sec": map[string]any{"type": "number", "default": 30},
+				"required": []string{"session_id", "current_step", "next_step"},
+			},
+			outputSchema(map[string]string{
+				"allowed":                "boolean",
+				"blocking_reasons":       "array|null",
+				"confidence":             "number",
+				"next_step":              "string",
+				"required_checks":        "array|null",
+				"suggested_next_actions": "array|null",
+			}),
+		),
+		newTool(
+			"run_action",
+			"Run allowlisted commands from approved plan",
+			commandTool,
+			(*MCPServer).toolRunActionContext,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"commands": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
 					},
-					"required": []string{"session_id", "commands", "executor_role", "executor_model"},
-				},
-			),
-			newTool(
-				"verify_result",
-				"Run verification commands",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"commands": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
-						"timeout_sec": map[string]any{"type": "number", "default": 120},
-						"available_mcps": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "MCP servers that can render visuals (e.g., playwright)",
-						},
-						"available_mcp_tools": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "MCP tools that can render visuals (e.g., playwright.screenshot)",
-						},
+					"executor_role": map[string]any{
+						"type":        "string",
+						"description": "Execution agent role. Must be a worker role (e.g., backend_worker, frontend_worker, implementation_worker).",
+					},
+					"executor_model": map[string]any{
+						"type":        "string",
+						"description": "Model used by execution agent. Must match routing_policy.worker_model.",
+					},
+					"delegated_by": map[string]any{
+						"type":        "string",
+						"description": "Manager/consultant role that delegated this implementation task.",
 					},
-					"required": []string{"session_id"},
+					"item_id": map[string]any{
+						"type":        "string",
+						"description": "Plan item to run. Required when the approved plan has more than one item.",
+					},
+					"lease_token": map[string]any{
+						"type":        "string",
+						"description": "Lease from claim_work_item; required while another worker's lease could hold the item.",
+					},
+					"dry_run":     map[string]any{"type": "boolean"},
+					"timeout_sec": map[string]any{"type": "number", "default": 30},
 				},
-			),
-			newTool(
-				"visual_review",
-				"Run Visual Reviewer checks and record UX Director meeting outcome",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"available_mcps": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
-						"available_mcp_tools": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
-						"artifacts": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "Rendered artifact paths/URLs (screenshots, recordings, etc.)",
-						},
-						"findings": map[string]any{
-							"type":        "array",
-							"items":       map[string]any{"type": "string"},
-							"description": "Visual Reviewer findings",
-						},
-						"reviewer_notes": map[string]any{
-							"type":        "string",
-							"description": "Visual quality/behavior verification notes",
-						},
-						"ux_director_summary": map[string]any{
-							"type":        "string",
-							"description": "UX Director meeting summary based on built artifact",
-						},
-						"ux_decision": map[string]any{
-							"type": "string",
-							"enum": []string{"pass", "raise"},
-						},
-						"skip_reason": map[string]any{
-							"type":        "string",
-							"description": "Reason for skipping visual review (e.g., no render target)",
-						},
+				"required": []string{"session_id", "commands", "executor_role", "executor_model"},
+			},
+			outputSchema(map[string]string{
+				"error":         "string",
+				"expected_step": "string",
+				"item_id":       "string",
+				"next_step":     "string",
+				"reason":        "string",
+				"results":       "array|null",
+				"session_id":    "string",
+				"status":        "string",
+				"step":          "string",
+				"work_items":    "object",
+			}),
+		),
+		newTool(
+			"verify_result",
+			"Run verification commands",
+			commandTool,
+			(*MCPServer).toolVerifyResultContext,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"item_id": map[string]any{
+						"type":        "string",
+						"description": "Plan item to verify after its run_action; defaults to the item's verify commands.",
+					},
+					"lease_token": map[string]any{"type": "string"},
+					"commands": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+					"criteria_checks": criteriaChecksSchema,
+					"timeout_sec":     map[string]any{"type": "number", "default": 120},
+					"available_mcps": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "MCP servers that can render visuals (e.g., playwright)",
+					},
+					"available_mcp_tools": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "MCP tools that can render visuals (e.g., playwright.screenshot)",
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"summarize",
-				"Summarize session intent-plan-execution-verification",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"criteria":        "array|null",
+				"error":           "string",
+				"fix_loop_count":  "number",
+				"item_id":         "string",
+				"next_step":       "string",
+				"persistent_max":  "number",
+				"persistent_mode": "string",
+				"required_next":   "string",
+				"results":         "array|null",
+				"session_id":      "string",
+				"status":          "string",
+				"step":            "string",
+				"visual_review":   "object",
+				"work_items":      "object",
+			}),
+		),
+		newTool(
+			"claim_work_item",
+			"Lease the next ready plan item (or item_id) to a worker so parallel workers never take the same item; leases expire unless renewed",
+			workflowTool,
+			contextFree((*MCPServer).toolClaimWorkItem),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"worker": map[string]any{
+						"type":        "string",
+						"description": "Identifier of the claiming worker agent, e.g. backend_worker-1.",
 					},
-					"required": []string{"session_id"},
+					"item_id":   map[string]any{"type": "string"},
+					"lease_sec": map[string]any{"type": "number", "default": 300},
 				},
-			),
-			newTool(
-				"record_user_feedback",
-				"Record user approval/feedback and decide next loop",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
-						"approved":   map[string]any{"type": "boolean"},
-						"feedback":   map[string]any{"type": "string"},
-						"required_fixes": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
+				"required": []string{"session_id", "worker"},
+			},
+			outputSchema(map[string]string{
+				"expected_step": "string",
+				"item":          "object",
+				"item_id":       "string",
+				"lease":         "object",
+				"next_step":     "string",
+				"reason":        "string",
+				"session_id":    "string",
+				"status":        "string",
+				"step":          "string",
+				"work_items":    "object",
+			}),
+		),
+		newTool(
+			"heartbeat_work_item",
+			"Renew a work item lease before it expires",
+			workflowTool,
+			contextFree((*MCPServer).toolHeartbeatWorkItem),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id":  map[string]any{"type": "string"},
+					"item_id":     map[string]any{"type": "string"},
+					"lease_token": map[string]any{"type": "string"},
+					"lease_sec":   map[string]any{"type": "number", "default": 300},
+				},
+				"required": []string{"session_id", "item_id", "lease_token"},
+			},
+			outputSchema(map[string]string{
+				"item_id":    "string",
+				"lease":      "object",
+				"session_id": "string",
+			}),
+		),
+		newTool(
+			"release_work_item",
+			"Give up a work item lease so another worker can claim the item",
+			workflowTool,
+			contextFree((*MCPServer).toolReleaseWorkItem),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id":  map[string]any{"type": "string"},
+					"item_id":     map[string]any{"type": "string"},
+					"lease_token": map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id", "item_id", "lease_token"},
+			},
+			outputSchema(map[string]string{
+				"item_id":    "string",
+				"next_step":  "string",
+				"released":   "boolean",
+				"session_id": "string",
+				"work_items": "object",
+			}),
+		),
+		newTool(
+			"visual_review",
+			"Run Visual Reviewer checks and record UX Director meeting outcome",
+			workflowTool,
+			contextFree((*MCPServer).toolVisualReview),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"available_mcps": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+					"available_mcp_tools": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+					"artifacts": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Rendered artifact paths/URLs (screenshots, recordings, etc.)",
+					},
+					"findings": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Visual Reviewer findings",
+					},
+					"reviewer_notes": map[string]any{
+						"type":        "string",
+						"description": "Visual quality/behavior verification notes",
+					},
+					"ux_director_summary": map[string]any{
+						"type":        "string",
+						"description": "UX Director meeting summary based on built artifact",
+					},
+					"ux_decision": map[string]any{
+						"type": "string",
+						"enum": []string{"pass", "raise"},
+					},
+					"skip_reason": map[string]any{
+						"type":        "string",
+						"description": "Reason for skipping visual review (e.g., no render target)",
 					},
-					"required": []string{"session_id", "approved"},
 				},
-			),
-			newTool(
-				"continue_persistent_execution",
-				"Resume persistent execution loop after failure/feedback",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"next_step":     "string",
+				"required":      "boolean",
+				"session_id":    "string",
+				"status":        "string",
+				"step":          "string",
+				"visual_review": "object",
+			}),
+		),
+		newTool(
+			"summarize",
+			"Summarize session intent-plan-execution-verification",
+			workflowTool,
+			contextFree((*MCPServer).toolSummarize),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"action_count":      "number",
+				"consultant_lang":   "string",
+				"council_consensus": "boolean",
+				"council_phase":     "string",
+				"criteria":          "array|null",
+				"fix_loop_count":    "number",
+				"intent":            "object",
+				"max_fix_loops":     "number",
+				"mockup":            "object|null",
+				"next":              "string",
+				"plan":              "object|null",
+				"proposal_accepted": "boolean",
+				"proposal_history":  "array|null",
+				"routing_policy":    "object",
+				"session_id":        "string",
+				"step":              "string",
+				"step_history":      "array|null",
+				"summary":           "string",
+				"user_approved":     "boolean",
+				"user_gate":         "string",
+				"verify_count":      "number",
+				"visual_review":     "object",
+			}),
+		),
+		newTool(
+			"record_user_feedback",
+			"Record user approval/feedback and decide next loop; when the client supports elicitation the user is asked directly",
+			workflowTool,
+			(*MCPServer).toolRecordUserFeedbackContext,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"approved":   map[string]any{"type": "boolean"},
+					"feedback":   map[string]any{"type": "string"},
+					"required_fixes": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"get_session_status",
-				"Get session status, step history, and next action",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"session_id": map[string]any{"type": "string"},
+				"required": []string{"session_id", "approved"},
+			},
+			outputSchema(map[string]string{
+				"decided_by":          "string",
+				"fix_loop_count":      "number",
+				"last_error":          "string",
+				"max_fix_loops":       "number",
+				"next_step":           "string",
+				"pending_review":      "array|null",
+				"session_id":          "string",
+				"status":              "string",
+				"step":                "string",
+				"unverified_criteria": "array|null",
+				"user_approved":       "boolean",
+			}),
+		),
+		newTool(
+			"continue_persistent_execution",
+			"Resume persistent execution loop after failure/feedback",
+			workflowTool,
+			contextFree((*MCPServer).toolContinuePersistentExecution),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"fix_loop_count": "number",
+				"last_error":     "string",
+				"max_fix_loops":  "number",
+				"next_step":      "string",
+				"session_id":     "string",
+				"step":           "string",
+				"user_approved":  "boolean",
+			}),
+		),
+		newTool(
+			"get_session_status",
+			"Get session status, step history, and next action",
+			readOnlyTool,
+			contextFree((*MCPServer).toolGetSessionStatus),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"action_count":          "number",
+				"approved_criteria":     "array|null",
+				"autostart_mode":        "string",
+				"autostart_session_id":  "string",
+				"available_mcp_tools":   "array|null",
+				"available_mcps":        "array|null",
+				"baseline_footprint":    "object",
+				"consultant_lang":       "string",
+				"council_consensus":     "boolean",
+				"council_managers":      "array|null",
+				"council_phase":         "string",
+				"criteria":              "array|null",
+				"criterion_checks":      "array|null",
+				"fix_loop_count":        "number",
+				"forked_from":           "string",
+				"forks":                 "array|null",
+				"last_error":            "string",
+				"last_footprint":        "object",
+				"max_fix_loops":         "number",
+				"mockup":                "object|null",
+				"next":                  "string",
+				"pending_review":        "array|null",
+				"plan_approved":         "boolean",
+				"plan_versions":         "array",
+				"approved_plan_version": "number",
+				"proposal_accepted":     "boolean",
+				"proposal_history":      "array|null",
+				"reconcile_needed":      "boolean",
+				"requirement_tags":      "array|null",
+				"routing_policy":        "object",
+				"session_id":            "string",
+				"step":                  "string",
+				"step_history":          "array|null",
+				"updated_at":            "string",
+				"user_approved":         "boolean",
+				"user_feedback":         "array|null",
+				"user_profile":          "object",
+				"verify_count":          "number",
+				"visual_review":         "object",
+				"work_items":            "object",
+			}),
+		),
+		newTool(
+			"autostart_set_mode",
+			"Set codex-troller autostart skill mode (on/off) for current MCP process",
+			workflowTool,
+			contextFree((*MCPServer).toolAutostartSetMode),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"mode":       map[string]any{"type": "string", "enum": []string{"on", "off"}},
+					"session_id": map[string]any{"type": "string"},
+					"reason":     map[string]any{"type": "string"},
+				},
+				"required": []string{"mode"},
+			},
+			outputSchema(map[string]string{
+				"active_session_id":    "string",
+				"message":              "string",
+				"mode":                 "string",
+				"next_step":            "string",
+				"reason":               "string",
+				"reset_on_mcp_restart": "boolean",
+			}),
+		),
+		newTool(
+			"autostart_get_mode",
+			"Get codex-troller autostart skill mode for current MCP process",
+			readOnlyTool,
+			contextFree((*MCPServer).toolAutostartGetMode),
+			map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			},
+			outputSchema(map[string]string{
+				"active_session_id":    "string",
+				"mode":                 "string",
+				"reset_on_mcp_restart": "boolean",
+			}),
+		),
+		newTool(
+			"git_get_state",
+			"Get git state (branch, HEAD, change summary)",
+			readOnlyTool,
+			contextFree((*MCPServer).toolGitGetState),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{"type": "string", "default": "."},
+				},
+			},
+			outputSchema(map[string]string{
+				"branch": "string",
+				"head":   "string",
+				"path":   "string",
+				"status": "string",
+			}),
+		),
+		newTool(
+			"git_diff_symbols",
+			"Map changed files between base/target to estimated symbols",
+			readOnlyTool,
+			contextFree((*MCPServer).toolGitDiffSymbols),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"base":              map[string]any{"type": "string"},
+					"target":            map[string]any{"type": "string", "default": "HEAD"},
+					"include_untracked": map[string]any{"type": "boolean", "default": false},
+				},
+				"required": []string{"base"},
+			},
+			outputSchema(map[string]string{
+				"base":              "string",
+				"changed_symbols":   "array|null",
+				"confidence":        "number",
+				"deleted_symbols":   "array|null",
+				"include_untracked": "boolean",
+				"renamed_symbols":   "array|null",
+				"target":            "string",
+				"tests_affected":    "array|null",
+			}),
+		),
+		newTool(
+			"git_commit_with_context",
+			"Create commit with requirement tags in commit message",
+			commandTool,
+			contextFree((*MCPServer).toolGitCommitWithContext),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"goal_id":          map[string]any{"type": "string"},
+					"goal_summary":     map[string]any{"type": "string"},
+					"requirement_tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					"agent_id":         map[string]any{"type": "string"},
+					"risk_level": map[string]any{
+						"type": "string",
+						"enum": []string{"low", "medium", "high"},
 					},
-					"required": []string{"session_id"},
 				},
-			),
-			newTool(
-				"autostart_set_mode",
-				"Set codex-troller autostart skill mode (on/off) for current MCP process",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"mode":       map[string]any{"type": "string", "enum": []string{"on", "off"}},
-						"session_id": map[string]any{"type": "string"},
-						"reason":     map[string]any{"type": "string"},
+				"required": []string{"goal_summary"},
+			},
+			outputSchema(map[string]string{
+				"commit_message": "string",
+				"commit_output":  "string",
+			}),
+		),
+		newTool(
+			"git_resolve_conflict",
+			"Guide conflict-resolution modes",
+			commandTool,
+			contextFree((*MCPServer).toolGitResolveConflict),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"files": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
 					},
-					"required": []string{"mode"},
+					"strategy": map[string]any{
+						"type": "string",
+						"enum": []string{"abort", "manual_review", "ours", "theirs", "skip"},
+					},
+					"notes": map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"autostart_get_mode",
-				"Get codex-troller autostart skill mode for current MCP process",
-				map[string]any{
-					"type":       "object",
-					"properties": map[string]any{},
+				"required": []string{"strategy", "files"},
+			},
+			outputSchema(map[string]string{
+				"notes":    "string",
+				"output":   "string",
+				"resolved": "boolean",
+				"strategy": "string",
+			}),
+		),
+		newTool(
+			"git_bisect_start",
+			"Start bisect for regression range",
+			commandTool,
+			contextFree((*MCPServer).toolGitBisectStart),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"good_commit":  map[string]any{"type": "string"},
+					"bad_commit":   map[string]any{"type": "string"},
+					"test_command": map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"git_get_state",
-				"Get git state (branch, HEAD, change summary)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"path": map[string]any{"type": "string", "default": "."},
+				"required": []string{"good_commit", "bad_commit"},
+			},
+			outputSchema(map[string]string{
+				"note":         "string",
+				"status":       "string",
+				"test_command": "string",
+			}),
+		),
+		newTool(
+			"git_recover_state",
+			"Recover local state (worktree/branch based)",
+			commandTool,
+			contextFree((*MCPServer).toolGitRecoverState),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"mode": map[string]any{
+						"type": "string",
+						"enum": []string{"checkout_safe_point", "undo_uncommitted", "restore_branch"},
 					},
+					"safe_point": map[string]any{"type": "string"},
+					"branch":     map[string]any{"type": "string"},
 				},
-			),
-			newTool(
-				"git_diff_symbols",
-				"Map changed files between base/target to estimated symbols",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"base":              map[string]any{"type": "string"},
-						"target":            map[string]any{"type": "string", "default": "HEAD"},
-						"include_untracked": map[string]any{"type": "boolean", "default": false},
+				"required": []string{"mode"},
+			},
+			outputSchema(map[string]string{
+				"branch":   "string",
+				"mode":     "string",
+				"output":   "string",
+				"restored": "boolean",
+			}),
+		),
+		newTool(
+			"state_recover",
+			"List state database backups and quarantined state files, or restore a backup by name",
+			stateTool,
+			contextFree((*MCPServer).toolStateRecover),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"backup": map[string]any{
+						"type":        "string",
+						"description": "Backup name to restore; omit to list backups",
 					},
-					"required": []string{"base"},
 				},
-			),
-			newTool(
-				"git_commit_with_context",
-				"Create commit with requirement tags in commit message",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"goal_id":          map[string]any{"type": "string"},
-						"goal_summary":     map[string]any{"type": "string"},
-						"requirement_tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
-						"agent_id":         map[string]any{"type": "string"},
-						"risk_level": map[string]any{
-							"type": "string",
-							"enum": []string{"low", "medium", "high"},
-						},
+			},
+			outputSchema(map[string]string{
+				"backups":       "array|null",
+				"restored":      "string",
+				"safety_backup": "string",
+				"sessions":      "number",
+			}),
+		),
+		newTool(
+			"list_sessions",
+			"List sessions newest first, filtered by step, update time, goal text, branch and requirement tags",
+			readOnlyTool,
+			contextFree((*MCPServer).toolListSessions),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"step":           map[string]any{"type": "string"},
+					"goal":           map[string]any{"type": "string", "description": "Text the intent goal contains"},
+					"branch":         map[string]any{"type": "string", "description": "Git branch the session started on"},
+					"tags":           map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Requirement tags the session must all have"},
+					"updated_after":  map[string]any{"type": "string", "description": "RFC 3339 time or YYYY-MM-DD date"},
+					"updated_before": map[string]any{"type": "string", "description": "RFC 3339 time or YYYY-MM-DD date"},
+					"limit":          map[string]any{"type": "integer", "description": "Page size, default 20, at most 100"},
+					"offset":         map[string]any{"type": "integer", "description": "next_offset from the previous page"},
+					"archived":       map[string]any{"type": "boolean", "description": "List archived sessions instead"},
+				},
+			},
+			outputSchema(map[string]string{
+				"next_offset": "number",
+				"sessions":    "array",
+				"total":       "number",
+			}),
+		),
+		newTool(
+			"search_sessions",
+			"Search sessions by text in the session ID, goal, raw intent or requirement tags",
+			readOnlyTool,
+			contextFree((*MCPServer).toolListSessions),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query":          map[string]any{"type": "string"},
+					"step":           map[string]any{"type": "string"},
+					"goal":           map[string]any{"type": "string", "description": "Text the intent goal contains"},
+					"branch":         map[string]any{"type": "string", "description": "Git branch the session started on"},
+					"tags":           map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Requirement tags the session must all have"},
+					"updated_after":  map[string]any{"type": "string", "description": "RFC 3339 time or YYYY-MM-DD date"},
+					"updated_before": map[string]any{"type": "string", "description": "RFC 3339 time or YYYY-MM-DD date"},
+					"limit":          map[string]any{"type": "integer", "description": "Page size, default 20, at most 100"},
+					"offset":         map[string]any{"type": "integer", "description": "next_offset from the previous page"},
+				},
+				"required": []string{"query"},
+			},
+			outputSchema(map[string]string{
+				"next_offset": "number",
+				"sessions":    "array",
+				"total":       "number",
+			}),
+		),
+		newTool(
+			"fork_session",
+			"Copy a session and its council rows into a new session to explore an alternative",
+			workflowTool,
+			contextFree((*MCPServer).toolForkSession),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"new_session_id": map[string]any{
+						"type":        "string",
+						"description": "ID for the fork; generated when omitted",
 					},
-					"required": []string{"goal_summary"},
 				},
-			),
-			newTool(
-				"git_resolve_conflict",
-				"Guide conflict-resolution modes",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"files": map[string]any{
-							"type":  "array",
-							"items": map[string]any{"type": "string"},
-						},
-						"strategy": map[string]any{
-							"type": "string",
-							"enum": []string{"abort", "manual_review", "ours", "theirs", "skip"},
-						},
-						"notes": map[string]any{"type": "string"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"forked_from": "string",
+				"forks":       "array",
+				"session_id":  "string",
+				"step":        "string",
+			}),
+		),
+		newTool(
+			"archive_session",
+			"Move a session and its council rows out of the database into a compressed archive bundle",
+			stateTool,
+			contextFree((*MCPServer).toolArchiveSession),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"reason":     map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"archive":    "string",
+				"archived":   "boolean",
+				"session_id": "string",
+			}),
+		),
+		newTool(
+			"restore_session",
+			"Bring an archived session and its council rows back from its archive bundle",
+			stateTool,
+			contextFree((*MCPServer).toolRestoreSession),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+				},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"restored":   "boolean",
+				"session_id": "string",
+				"snapshots":  "number",
+				"step":       "string",
+			}),
+		),
+		newTool(
+			"export_session",
+			"Write a session, its council rows and its artifact files to one portable bundle",
+			workflowTool,
+			contextFree((*MCPServer).toolExportSession),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Bundle file to write; defaults to the exports directory next to the state database",
 					},
-					"required": []string{"strategy", "files"},
 				},
-			),
-			newTool(
-				"git_bisect_start",
-				"Start bisect for regression range",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"good_commit":  map[string]any{"type": "string"},
-						"bad_commit":   map[string]any{"type": "string"},
-						"test_command": map[string]any{"type": "string"},
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"artifacts":         "number",
+				"path":              "string",
+				"session_id":        "string",
+				"skipped_artifacts": "array",
+			}),
+		),
+		newTool(
+			"import_session",
+			"Verify an export bundle and load it as a new session, remapping its ID",
+			workflowTool,
+			contextFree((*MCPServer).toolImportSession),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{"type": "string"},
+					"new_session_id": map[string]any{
+						"type":        "string",
+						"description": "ID for the imported session; defaults to the exported ID, or a new one when that is taken",
 					},
-					"required": []string{"good_commit", "bad_commit"},
 				},
-			),
-			newTool(
-				"git_recover_state",
-				"Recover local state (worktree/branch based)",
-				map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"mode": map[string]any{
-							"type": "string",
-							"enum": []string{"checkout_safe_point", "undo_uncommitted", "restore_branch"},
-						},
-						"safe_point": map[string]any{"type": "string"},
-						"branch":     map[string]any{"type": "string"},
+				"required": []string{"path"},
+			},
+			outputSchema(map[string]string{
+				"artifacts":         "number",
+				"session_id":        "string",
+				"source_session_id": "string",
+				"step":              "string",
+			}),
+		),
+		newTool(
+			"rewind_session",
+			"List a session's snapshots, or restore the session and its council rows to one of them",
+			stateTool,
+			contextFree((*MCPServer).toolRewindSession),
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"snapshot": map[string]any{
+						"type":        "integer",
+						"description": "Snapshot index to restore; omit to list snapshots",
 					},
-					"required": []string{"mode"},
 				},
-			),
-		},
-	}
-}
-
-func newTool(name, description string, schema map[string]any) toolSchema {
-	return toolSchema{
-		Name:        name,
-		Description: description,
-		InputSchema: schema,
+				"required": []string{"session_id"},
+			},
+			outputSchema(map[string]string{
+				"rewound_to":   "number",
+				"session_id":   "string",
+				"snapshots":    "array",
+				"step":         "string",
+				"step_history": "array",
+			}),
+		),
 	}
 }
 
@@ -1608,8 +2384,12 @@ func (s *MCPServer) toolIngestIntent(raw json.RawMessage) (any, error) {
 func resetWorkflowState(session *SessionState) {
 	session.Step = StepReceived
 	session.StepHistory = []WorkStep{StepReceived}
+	session.transitions++
 	session.Plan = nil
 	session.Mockup = nil
+	session.PlanVersions = nil
+	session.PlanFeedback = nil
+	session.ApprovedVersion = 0
 	session.ProposalHistory = nil
 	session.ProposalAccepted = false
 	session.RequirementTags = nil
@@ -1617,6 +2397,9 @@ func resetWorkflowState(session *SessionState) {
 	session.CouncilConsensus = false
 	session.CouncilPhase = ""
 	session.PlanApproved = false
+	session.WorkItems = nil
+	session.CriterionChecks = nil
+	session.CriteriaReport = nil
 	session.UserApproved = false
 	session.UserFeedback = nil
 	session.FixLoopCount = 0
@@ -1711,6 +2494,10 @@ func suggestClarifyQuestions(intent Intent) []string {
 }
 
 func (s *MCPServer) toolClarifyIntent(raw json.RawMessage) (any, error) {
+	return s.toolClarifyIntentContext(context.Background(), raw)
+}
+
+func (s *MCPServer) toolClarifyIntentContext(ctx context.Context, raw json.RawMessage) (any, error) {
 	var args struct {
 		SessionID string         `json:"session_id"`
 		Answers   map[string]any `json:"answers"`
@@ -1720,7 +2507,22 @@ func (s *MCPServer) toolClarifyIntent(raw json.RawMessage) (any, error) {
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepIntentCaptured {
-		return nil, fmt.Errorf("clarify intent requires intent_captured state")
+		return nil, stepGateError(session, "clarify intent requires intent_captured state", StepIntentCaptured)
+	}
+	// Ask the pending consultant question directly unless the agent already
+	// relayed an answer for that topic.
+	if pending := buildClarifyDecision(session); pending.Question != "" && !answersTopic(args.Answers, pending.QuestionTopic) {
+		answer, asked, err := s.elicitClarifyAnswer(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+		if asked && answer.accepted() && answer.text("answer") != "" {
+			if args.Answers == nil {
+				args.Answers = map[string]any{}
+			}
+			args.Answers[pending.QuestionTopic] = answer.text("answer")
+			recordUserDecision(session, "clarify_intent", pending.QuestionTopic, decidedByUser, answer.text("answer"))
+		}
 	}
 	updateConsultantLanguage(session, answersToText(args.Answers))
 
@@ -1837,16 +2639,26 @@ func (s *MCPServer) toolClarifyIntent(raw json.RawMessage) (any, error) {
 	}, nil
 }
 
+func answersTopic(answers map[string]any, topic string) bool {
+	for key := range answers {
+		if normalizeTopicKey(key) == topic {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *MCPServer) toolGeneratePlan(raw json.RawMessage) (any, error) {
 	var args struct {
-		SessionID string `json:"session_id"`
+		SessionID string     `json:"session_id"`
+		Items     []PlanItem `json:"items"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
 		return nil, err
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepIntentCaptured {
-		return nil, fmt.Errorf("generate plan requires intent_captured state")
+		return nil, stepGateError(session, "generate plan requires intent_captured state", StepIntentCaptured)
 	}
 	if !session.CouncilConsensus {
 		return nil, fmt.Errorf("generate plan requires council consensus; call council_start_briefing and council_finalize_consensus first")
@@ -1857,20 +2669,69 @@ func (s *MCPServer) toolGeneratePlan(raw json.RawMessage) (any, error) {
 	if !session.ProposalAccepted {
 		return nil, fmt.Errorf("generate plan requires proposal alignment; continue clarify_intent first")
 	}
+	items := defaultPlanItems(session)
+	if len(args.Items) > 0 {
+		items = normalizePlanItems(args.Items)
+	}
+	if problems := validatePlanItems(session, items, s.cfg.AllowedCommands); len(problems) > 0 {
+		return nil, &toolFailure{
+			SessionID: session.SessionID,
+			Step:      session.Step,
+			NextStep:  "generate_plan",
+			Reason:    "invalid plan items: " + strings.Join(problems, "; "),
+		}
+	}
 	plan := &Plan{
 		Title:       fmt.Sprintf("Plan for %s", session.Intent.Goal),
-		Steps:       []string{"Reconfirm requirement consistency", "Break down into executable units", "Prioritize work items", "Define verification checkpoints", "Finalize summary and approval checkpoints"},
+		Items:       items,
 		Assumptions: append(session.Intent.Assumptions, session.ClarifyNotes...),
 		Risks:       []string{"Plan drift when requirements are not explicit", "Side effects from dependency changes"},
 	}
+	recordPlanVersion(session, plan)
 	session.Plan = plan
+	session.WorkItems = nil
 	session.SetStep(StepPlanGenerated)
 	session.UpdatedAt = time.Now().UTC()
 	return map[string]any{
-		"session_id": session.SessionID,
-		"step":       session.Step,
-		"plan":       plan,
-		"next_step":  "generate_mockup",
+		"session_id":   session.SessionID,
+		"step":         session.Step,
+		"plan":         plan,
+		"plan_version": plan.Version,
+		"order":        planItemOrder(items),
+		"next_step":    "generate_mockup",
+	}, nil
+}
+
+func (s *MCPServer) toolDiffPlan(raw json.RawMessage) (any, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		From      int    `json:"from"`
+		To        int    `json:"to"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	from, to, err := resolvePlanVersions(session, args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffPlans(from.Plan, to.Plan)
+	var title any
+	if diff.Title != nil {
+		title = diff.Title
+	}
+	return map[string]any{
+		"session_id":            session.SessionID,
+		"from":                  diff.From,
+		"to":                    diff.To,
+		"title":                 title,
+		"items":                 diff.Items,
+		"assumptions":           diff.Assumptions,
+		"risks":                 diff.Risks,
+		"feedback":              to.Feedback,
+		"approved_plan_version": session.ApprovedVersion,
+		"versions":              planVersionSummaries(session),
 	}, nil
 }
 
@@ -1883,7 +2744,7 @@ func (s *MCPServer) toolGenerateMockup(raw json.RawMessage) (any, error) {
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepPlanGenerated {
-		return nil, fmt.Errorf("generate_mockup requires plan_generated state")
+		return nil, stepGateError(session, "generate_mockup requires plan_generated state", StepPlanGenerated)
 	}
 
 	version := 1
@@ -1903,6 +2764,7 @@ func (s *MCPServer) toolGenerateMockup(raw json.RawMessage) (any, error) {
 		CreatedAt:     time.Now().UTC(),
 	}
 
+	attachMockup(session, mockup)
 	session.Mockup = mockup
 	session.SetStep(StepMockupReady)
 	session.UpdatedAt = time.Now().UTC()
@@ -1915,19 +2777,48 @@ func (s *MCPServer) toolGenerateMockup(raw json.RawMessage) (any, error) {
 }
 
 func (s *MCPServer) toolApprovePlan(raw json.RawMessage) (any, error) {
+	return s.toolApprovePlanContext(context.Background(), raw)
+}
+
+func (s *MCPServer) toolApprovePlanContext(ctx context.Context, raw json.RawMessage) (any, error) {
 	var args struct {
-		SessionID       string   `json:"session_id"`
-		Approved        bool     `json:"approved"`
-		Notes           string   `json:"notes"`
-		RequirementTags []string `json:"requirement_tags"`
-		SuccessCriteria []string `json:"success_criteria"`
+		SessionID       string           `json:"session_id"`
+		Approved        bool             `json:"approved"`
+		Notes           string           `json:"notes"`
+		RequirementTags []string         `json:"requirement_tags"`
+		SuccessCriteria []string         `json:"success_criteria"`
+		CriteriaChecks  []CriterionCheck `json:"criteria_checks"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
 		return nil, err
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepMockupReady {
-		return nil, fmt.Errorf("approve plan requires mockup_ready state")
+		return nil, stepGateError(session, "approve plan requires mockup_ready state", StepMockupReady)
+	}
+	decidedBy := decidedByAgent
+	var requiredFixes []string
+	answer, asked, err := s.elicitPlanApproval(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if asked {
+		if !answer.accepted() {
+			return nil, elicitationDeclined(session, "approve_plan", answer)
+		}
+		decidedBy = decidedByUser
+		args.Approved = answer.text("decision") == "approve"
+		args.Notes = answer.text("notes")
+		requiredFixes = answer.lines("required_fixes")
+	}
+	decision := "reject"
+	if args.Approved {
+		decision = "approve"
+	}
+	recordUserDecision(session, "approve_plan", decision, decidedBy, args.Notes)
+	version, _ := currentPlanVersion(session)
+	if version != nil {
+		session.UserDecisions[len(session.UserDecisions)-1].PlanVersion = version.Version
 	}
 	if args.Approved {
 		session.RequirementTags = mergeUniqueStrings(session.RequirementTags, args.RequirementTags...)
@@ -1940,6 +2831,8 @@ func (s *MCPServer) toolApprovePlan(raw json.RawMessage) (any, error) {
 		if len(missingCriteria) > 0 {
 			missingCriteria = append(missingCriteria, "Provided success criteria do not match intent criteria")
 		}
+		checks, checkProblems, unbound := bindCriterionChecks(session, args.CriteriaChecks, s.cfg.AllowedCommands)
+		missingCriteria = append(append(missingCriteria, checkProblems...), unboundProblems(unbound)...)
 		if len(missingTags) > 0 || len(missingCriteria) > 0 {
 			session.LastError = "Approval requirements not satisfied"
 			session.SetStep(StepFailed)
@@ -1960,17 +2853,30 @@ func (s *MCPServer) toolApprovePlan(raw json.RawMessage) (any, error) {
 				"step":             session.Step,
 				"approved":         false,
 				"blocking_reasons": append(missingTags, missingCriteria...),
-				"required_actions": []string{"Provide at least one requirement tag", "Re-enter requirement success criteria"},
+				"required_actions": []string{"Provide at least one requirement tag", "Re-enter requirement success criteria", "Bind every success criterion to a check in criteria_checks or an item's verify commands"},
 				"session_requirements": map[string]any{
 					"intent_success_criteria": session.Intent.SuccessCriteria,
 					"approved_criteria":       session.ApprovedCriteria,
 					"requirement_tags":        session.RequirementTags,
 				},
-				"notes": args.Notes,
+				"notes":      args.Notes,
+				"decided_by": decidedBy,
 			}, nil
 		}
 
+		if s.council != nil {
+			if err := s.council.releaseSessionLeases(session.SessionID); err != nil {
+				return nil, err
+			}
+		}
 		session.PlanApproved = true
+		if version != nil {
+			version.Decision = planDecisionApproved
+			session.ApprovedVersion = version.Version
+		}
+		session.CriterionChecks = checks
+		session.CriteriaReport = nil
+		startWorkItems(session)
 		session.VisualReview = VisualReviewState{
 			Status: "not_required",
 		}
@@ -1981,6 +2887,14 @@ func (s *MCPServer) toolApprovePlan(raw json.RawMessage) (any, error) {
 		if args.Notes != "" {
 			session.PendingReview = append(session.PendingReview, "mockup feedback: "+args.Notes)
 		}
+		session.PendingReview = mergeUniqueStrings(session.PendingReview, requiredFixes...)
+		if version != nil {
+			version.Decision = planDecisionRejected
+		}
+		if args.Notes != "" {
+			notePlanFeedback(session, "mockup feedback: "+args.Notes)
+		}
+		notePlanFeedback(session, requiredFixes...)
 		session.SetStep(StepIntentCaptured)
 		session.LastError = "Re-planning required after mockup feedback"
 	}
@@ -1989,12 +2903,19 @@ func (s *MCPServer) toolApprovePlan(raw json.RawMessage) (any, error) {
 	if !session.PlanApproved {
 		nextStep = "generate_plan"
 	}
+	planVersionNumber := 0
+	if version != nil {
+		planVersionNumber = version.Version
+	}
 	return map[string]any{
-		"session_id": session.SessionID,
-		"step":       session.Step,
-		"approved":   session.PlanApproved,
-		"notes":      args.Notes,
-		"next_step":  nextStep,
+		"session_id":       session.SessionID,
+		"step":             session.Step,
+		"approved":         session.PlanApproved,
+		"plan_version":     planVersionNumber,
+		"criterion_checks": session.CriterionChecks,
+		"notes":            args.Notes,
+		"next_step":        nextStep,
+		"decided_by":       decidedBy,
 	}, nil
 }
 
@@ -2790,12 +3711,18 @@ func (s *MCPServer) toolValidateTransition(raw json.RawMessage) (any, error) {
 }
 
 func (s *MCPServer) toolRunAction(raw json.RawMessage) (any, error) {
+	return s.toolRunActionContext(context.Background(), raw)
+}
+
+func (s *MCPServer) toolRunActionContext(ctx context.Context, raw json.RawMessage) (any, error) {
 	var args struct {
 		SessionID     string   `json:"session_id"`
 		Commands      []string `json:"commands"`
 		ExecutorRole  string   `json:"executor_role"`
 		ExecutorModel string   `json:"executor_model"`
 		DelegatedBy   string   `json:"delegated_by"`
+		ItemID        string   `json:"item_id"`
+		LeaseToken    string   `json:"lease_token"`
 		DryRun        bool     `json:"dry_run"`
 		Timeout       int      `json:"timeout_sec"`
 	}
@@ -2804,14 +3731,7 @@ func (s *MCPServer) toolRunAction(raw json.RawMessage) (any, error) {
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepPlanApproved {
-		return map[string]any{
-			"session_id":    session.SessionID,
-			"status":        "blocked",
-			"reason":        "run_action requires plan_approved state",
-			"step":          session.Step,
-			"expected_step": StepPlanApproved,
-			"next_step":     nextAction(session),
-		}, nil
+		return nil, stepGateError(session, "run_action requires plan_approved state", StepPlanApproved)
 	}
 	if len(args.Commands) == 0 {
 		return nil, fmt.Errorf("commands is required")
@@ -2834,107 +3754,247 @@ func (s *MCPServer) toolRunAction(raw json.RawMessage) (any, error) {
 	if expectedWorkerModel != "" && executorModel != expectedWorkerModel {
 		return nil, fmt.Errorf("executor_model %q does not match routing_policy.worker_model %q", executorModel, expectedWorkerModel)
 	}
-
-	timeout := time.Duration(args.Timeout)
-	if timeout <= 0 {
-		timeout = 30
-	}
-
 	for _, cmd := range args.Commands {
 		if !isAllowedCommand(cmd, s.cfg.AllowedCommands) {
 			return nil, fmt.Errorf("command not allowed: %s", cmd)
 		}
-
-		start := time.Now()
-		if args.DryRun {
-			session.ActionResults = append(session.ActionResults, CommandResult{Command: cmd, ExitCode: 0, Stdout: "DRY RUN", DurationMS: int64(time.Since(start).Milliseconds())})
-			continue
-		}
-
-		stdout, stderr, code, err := runCommandWithTimeout(context.Background(), cmd, s.cfg.WorkDir, timeout)
-		res := CommandResult{Command: cmd, ExitCode: code, Stdout: stdout, Stderr: stderr, DurationMS: int64(time.Since(start).Milliseconds())}
-		if err != nil {
-			res.Error = err.Error()
+	}
+	// With item_id only that plan item runs and the session stays at
+	// plan_approved until every item is verified.
+	itemMode := strings.TrimSpace(args.ItemID) != ""
+	item, planItem, err := selectWorkItem(session, strings.TrimSpace(args.ItemID), "run_action")
+	if err != nil {
+		return nil, err
+	}
+	previousStatus := ""
+	if item != nil {
+		switch item.Status {
+		case itemDone:
+			return nil, fmt.Errorf("work item %q is already done", item.ID)
+		case itemBlocked:
+			return nil, &toolFailure{
+				SessionID: session.SessionID,
+				Step:      session.Step,
+				NextStep:  "run_action",
+				Reason:    fmt.Sprintf("work item %q is blocked by %s", item.ID, strings.Join(unfinishedDependencies(session, planItem), ", ")),
+			}
+		}
+		if err := s.checkItemLease(session, item.ID, strings.TrimSpace(args.LeaseToken), "run_action"); err != nil {
+			return nil, err
+		}
+		previousStatus = item.Status
+		item.Attempts++
+		setWorkItemStatus(item, itemInProgress, "")
+	}
+	itemID := ""
+	if item != nil {
+		itemID = item.ID
+	}
+
+	timeout := time.Duration(args.Timeout)
+	if timeout <= 0 {
+		timeout = 30
+	}
+	if itemMode && !args.DryRun {
+		return s.runWorkItemAction(ctx, session, itemID, previousStatus, args.Commands, timeout)
+	}
+
+	progress := progressFromContext(ctx)
+	for i, cmd := range args.Commands {
+		start := time.Now()
+		shown, _ := s.redactor.forCommand(cmd).redact(cmd)
+		progress.commandStarted(i, len(args.Commands), shown)
+		if args.DryRun {
+			res := s.redactor.redactResult(CommandResult{Command: cmd, ExitCode: 0, Stdout: "DRY RUN", DurationMS: int64(time.Since(start).Milliseconds()), Status: commandStatusDryRun})
+			res.ItemID = itemID
+			session.ActionResults = append(session.ActionResults, res)
+			progress.commandFinished(i, len(args.Commands), res)
+			continue
 		}
+
+		res := s.runRedacted(ctx, progress, i, len(args.Commands), cmd, shown, timeout)
+		res.ItemID = itemID
 		session.ActionResults = append(session.ActionResults, res)
-		if code != 0 {
-			session.SetStep(StepFailed)
+		progress.commandFinished(i, len(args.Commands), res)
+		if res.Status == commandStatusCancelled {
+			// Cancellation leaves the session at plan_approved so the
+			// remaining work can be re-run deliberately.
+			if item != nil {
+				setWorkItemStatus(item, previousStatus, item.LastError)
+			}
+			session.LastError = "run_action cancelled by client"
+			session.UpdatedAt = time.Now().UTC()
+			return map[string]any{
+				"session_id": session.SessionID,
+				"step":       session.Step,
+				"status":     commandStatusCancelled,
+				"item_id":    itemID,
+				"results":    session.ActionResults,
+				"work_items": workItemBoard(session, s.workItemLeases(session.SessionID)),
+				"error":      session.LastError,
+				"next_step":  nextAction(session),
+			}, nil
+		}
+		if res.ExitCode != 0 {
+			if item != nil {
+				setWorkItemStatus(item, itemFailed, res.Error)
+			}
 			session.LastError = res.Error
 			session.UpdatedAt = time.Now().UTC()
-			return map[string]any{"session_id": session.SessionID, "step": session.Step, "results": session.ActionResults, "error": res.Error}, nil
+			session.SetStep(StepFailed)
+			return map[string]any{"session_id": session.SessionID, "step": session.Step, "results": session.ActionResults, "work_items": workItemBoard(session, s.workItemLeases(session.SessionID)), "error": res.Error}, nil
 		}
 	}
-	session.SetStep(StepActionExecuted)
+	if !itemMode {
+		session.SetStep(StepActionExecuted)
+	}
 	session.UpdatedAt = time.Now().UTC()
-	return map[string]any{"session_id": session.SessionID, "step": session.Step, "results": session.ActionResults}, nil
+	return map[string]any{
+		"session_id": session.SessionID,
+		"step":       session.Step,
+		"item_id":    itemID,
+		"results":    session.ActionResults,
+		"work_items": workItemBoard(session, s.workItemLeases(session.SessionID)),
+		"next_step":  nextAction(session),
+	}, nil
 }
 
 func (s *MCPServer) toolVerifyResult(raw json.RawMessage) (any, error) {
+	return s.toolVerifyResultContext(context.Background(), raw)
+}
+
+func (s *MCPServer) toolVerifyResultContext(ctx context.Context, raw json.RawMessage) (any, error) {
 	var args struct {
-		SessionID         string   `json:"session_id"`
-		Commands          []string `json:"commands"`
-		Timeout           int      `json:"timeout_sec"`
-		AvailableMCPs     []string `json:"available_mcps"`
-		AvailableMCPTools []string `json:"available_mcp_tools"`
+		SessionID         string           `json:"session_id"`
+		ItemID            string           `json:"item_id"`
+		LeaseToken        string           `json:"lease_token"`
+		Commands          []string         `json:"commands"`
+		CriteriaChecks    []CriterionCheck `json:"criteria_checks"`
+		Timeout           int              `json:"timeout_sec"`
+		AvailableMCPs     []string         `json:"available_mcps"`
+		AvailableMCPTools []string         `json:"available_mcp_tools"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
 		return nil, err
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	mergeMCPInventory(session, args.AvailableMCPs, args.AvailableMCPTools)
-	if session.Step != StepActionExecuted {
-		return nil, fmt.Errorf("verify_result requires action_executed state")
-	}
-	cmds := args.Commands
-	if len(cmds) == 0 {
-		cmds = []string{"go test ./..."}
-	}
 	timeout := time.Duration(args.Timeout)
 	if timeout <= 0 {
 		timeout = 120
 	}
-
-	for _, cmd := range cmds {
+	if itemID := strings.TrimSpace(args.ItemID); itemID != "" {
+		return s.verifyWorkItem(ctx, session, itemID, strings.TrimSpace(args.LeaseToken), args.Commands, timeout)
+	}
+	// A session approved with criteria that never passed their checks can
+	// be verified again from verify_run, with checks bound late.
+	reverify := session.Step == StepVerifyRun && len(unverifiedCriteria(session)) > 0
+	if session.Step != StepActionExecuted && !reverify {
+		return nil, stepGateError(session, "verify_result requires action_executed state", StepActionExecuted)
+	}
+	if len(args.CriteriaChecks) > 0 {
+		// Criteria still unbound stay unverified rather than failing the call.
+		checks, problems, _ := bindCriterionChecks(session, append(append([]CriterionCheck{}, session.CriterionChecks...), args.CriteriaChecks...), s.cfg.AllowedCommands)
+		if len(problems) > 0 {
+			return nil, fmt.Errorf("invalid criteria_checks: %s", strings.Join(problems, "; "))
+		}
+		session.CriterionChecks = checks
+	}
+	cmds := args.Commands
+	if len(cmds) == 0 && len(session.CriterionChecks) == 0 {
+		cmds = []string{"go test ./..."}
+	}
+	checkCmds := checkCommands(session.CriterionChecks)
+	for _, cmd := range append(append([]string{}, cmds...), checkCmds...) {
 		if !isAllowedCommand(cmd, s.cfg.AllowedCommands) {
 			return nil, fmt.Errorf("command not allowed: %s", cmd)
 		}
+	}
+	total := len(cmds) + len(checkCmds)
 
-		start := time.Now()
-		stdout, stderr, code, err := runCommandWithTimeout(context.Background(), cmd, s.cfg.WorkDir, timeout)
-		res := CommandResult{Command: cmd, ExitCode: code, Stdout: stdout, Stderr: stderr, DurationMS: int64(time.Since(start).Milliseconds())}
-		if err != nil {
-			res.Error = err.Error()
-		}
-		session.VerifyResults = append(session.VerifyResults, res)
-		if code != 0 {
-			session.FixLoopCount++
-			session.UserApproved = false
-			session.LastError = res.Error
-			session.PendingReview = append(session.PendingReview, fmt.Sprintf("Verification failed (%s): %s", cmd, res.Error))
-			if session.FixLoopCount >= session.MaxFixLoops {
-				session.SetStep(StepFailed)
-				session.LastError = fmt.Sprintf("Verification failed %d times; manual intervention required", session.FixLoopCount)
-				session.UpdatedAt = time.Now().UTC()
-				return map[string]any{
-					"session_id":     session.SessionID,
-					"step":           session.Step,
-					"results":        session.VerifyResults,
-					"error":          session.LastError,
-					"persistent_max": session.MaxFixLoops,
-					"required_next":  []string{"reconfirm requirements", "after manual intervention, run continue_persistent_execution"},
-				}, nil
-			}
-			session.SetStep(StepIntentCaptured)
+	failed := func(label, reason string) map[string]any {
+		session.FixLoopCount++
+		session.UserApproved = false
+		session.LastError = reason
+		session.PendingReview = append(session.PendingReview, fmt.Sprintf("Verification failed (%s): %s", label, reason))
+		notePlanFeedback(session, fmt.Sprintf("Verification failed (%s): %s", label, reason))
+		if session.FixLoopCount >= session.MaxFixLoops {
+			session.SetStep(StepFailed)
+			session.LastError = fmt.Sprintf("Verification failed %d times; manual intervention required", session.FixLoopCount)
 			session.UpdatedAt = time.Now().UTC()
 			return map[string]any{
-				"session_id":      session.SessionID,
-				"step":            session.Step,
-				"results":         session.VerifyResults,
-				"error":           res.Error,
-				"persistent_mode": "continue",
-				"next_step":       "generate_plan",
-				"fix_loop_count":  session.FixLoopCount,
-			}, nil
+				"session_id":     session.SessionID,
+				"step":           session.Step,
+				"results":        session.VerifyResults,
+				"criteria":       session.CriteriaReport,
+				"error":          session.LastError,
+				"persistent_max": session.MaxFixLoops,
+				"required_next":  []string{"reconfirm requirements", "after manual intervention, run continue_persistent_execution"},
+			}
+		}
+		session.SetStep(StepIntentCaptured)
+		session.UpdatedAt = time.Now().UTC()
+		return map[string]any{
+			"session_id":      session.SessionID,
+			"step":            session.Step,
+			"results":         session.VerifyResults,
+			"criteria":        session.CriteriaReport,
+			"error":           reason,
+			"persistent_mode": "continue",
+			"next_step":       "generate_plan",
+			"fix_loop_count":  session.FixLoopCount,
+		}
+	}
+	cancelled := func() map[string]any {
+		// An aborted verification is not a failed one: stay at
+		// action_executed without consuming a fix loop.
+		session.LastError = "verify_result cancelled by client"
+		session.UpdatedAt = time.Now().UTC()
+		return map[string]any{
+			"session_id": session.SessionID,
+			"step":       session.Step,
+			"status":     commandStatusCancelled,
+			"results":    session.VerifyResults,
+			"criteria":   session.CriteriaReport,
+			"error":      session.LastError,
+			"next_step":  nextAction(session),
+		}
+	}
+
+	progress := progressFromContext(ctx)
+	run := func(i int, cmd string) CommandResult {
+		shown, _ := s.redactor.forCommand(cmd).redact(cmd)
+		progress.commandStarted(i, total, shown)
+		res := s.runRedacted(ctx, progress, i, total, cmd, shown, timeout)
+		session.VerifyResults = append(session.VerifyResults, res)
+		progress.commandFinished(i, total, res)
+		return res
+	}
+	for i, cmd := range cmds {
+		res := run(i, cmd)
+		if res.Status == commandStatusCancelled {
+			return cancelled(), nil
+		}
+		if res.ExitCode != 0 {
+			return failed(res.Command, res.Error), nil
+		}
+	}
+	results := map[string]CommandResult{}
+	for j, cmd := range checkCmds {
+		res := run(len(cmds)+j, cmd)
+		results[cmd] = res
+		if res.Status == commandStatusCancelled {
+			session.CriteriaReport = criteriaReport(session, results)
+			return cancelled(), nil
+		}
+	}
+	session.CriteriaReport = criteriaReport(session, results)
+	if failing := criteriaWithStatus(session.CriteriaReport, criterionFail); len(failing) > 0 {
+		return failed("criteria", "success criteria failed: "+strings.Join(failing, "; ")), nil
+	}
+	for i := range session.WorkItems {
+		if session.WorkItems[i].Status == itemInProgress {
+			setWorkItemStatus(&session.WorkItems[i], itemDone, "")
 		}
 	}
 	session.SetStep(StepVerifyRun)
@@ -2951,11 +4011,167 @@ func (s *MCPServer) toolVerifyResult(raw json.RawMessage) (any, error) {
 		"session_id":    session.SessionID,
 		"step":          session.Step,
 		"results":       session.VerifyResults,
+		"criteria":      session.CriteriaReport,
+		"work_items":    workItemBoard(session, s.workItemLeases(session.SessionID)),
 		"visual_review": session.VisualReview,
 		"next_step":     nextAction(session),
 	}, nil
 }
 
+func (s *MCPServer) toolClaimWorkItem(raw json.RawMessage) (any, error) {
+	if s.council == nil {
+		return nil, fmt.Errorf("council store is not available")
+	}
+	var args struct {
+		SessionID string `json:"session_id"`
+		Worker    string `json:"worker"`
+		ItemID    string `json:"item_id"`
+		LeaseSec  int    `json:"lease_sec"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	worker := strings.TrimSpace(args.Worker)
+	if worker == "" {
+		return nil, fmt.Errorf("worker is required")
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	if session.Step != StepPlanApproved {
+		return nil, stepGateError(session, "claim_work_item requires plan_approved state", StepPlanApproved)
+	}
+	if len(session.WorkItems) == 0 {
+		return nil, fmt.Errorf("the approved plan has no work items to claim")
+	}
+	now := time.Now()
+	leases, err := s.council.activeLeases(session.SessionID, now)
+	if err != nil {
+		return nil, err
+	}
+	candidates := planItemOrder(session.Plan.Items)
+	if itemID := strings.TrimSpace(args.ItemID); itemID != "" {
+		state, planItem, ok := workItem(session, itemID)
+		if !ok {
+			return nil, fmt.Errorf("unknown work item %q", itemID)
+		}
+		if !workItemReady(state) {
+			reason := fmt.Sprintf("work item %q is %s", itemID, state.Status)
+			if state.Status == itemBlocked {
+				reason += " by " + strings.Join(unfinishedDependencies(session, planItem), ", ")
+			}
+			return nil, &toolFailure{SessionID: session.SessionID, Step: session.Step, NextStep: "claim_work_item", Reason: reason}
+		}
+		if lease, ok := leases[itemID]; ok {
+			return nil, &toolFailure{
+				SessionID: session.SessionID,
+				Step:      session.Step,
+				NextStep:  "claim_work_item",
+				Reason:    fmt.Sprintf("work item %q is leased to %s until %s", itemID, lease.Worker, lease.ExpiresAt.Format(time.RFC3339)),
+			}
+		}
+		candidates = []string{itemID}
+	}
+	for _, id := range candidates {
+		state, planItem, ok := workItem(session, id)
+		if !ok || !workItemReady(state) {
+			continue
+		}
+		if _, leased := leases[id]; leased {
+			continue
+		}
+		lease, claimed, err := s.council.claimLease(session.SessionID, id, worker, leaseDuration(args.LeaseSec), now)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			// Another process took it between the read and the claim.
+			continue
+		}
+		leases[id] = lease
+		session.UpdatedAt = time.Now().UTC()
+		return map[string]any{
+			"session_id": session.SessionID,
+			"step":       session.Step,
+			"status":     "claimed",
+			"item_id":    id,
+			"item":       planItem,
+			"lease":      lease,
+			"work_items": workItemBoard(session, leases),
+			"next_step":  "run_action",
+		}, nil
+	}
+	reason := "every ready work item is leased to another worker; retry after a lease expires"
+	if allWorkItemsDone(session) {
+		reason = "all work items are done"
+	} else if len(leases) == 0 {
+		reason = "remaining work items are blocked by unfinished dependencies"
+	}
+	return map[string]any{
+		"session_id": session.SessionID,
+		"step":       session.Step,
+		"status":     "none_ready",
+		"reason":     reason,
+		"work_items": workItemBoard(session, leases),
+		"next_step":  nextAction(session),
+	}, nil
+}
+
+func (s *MCPServer) toolHeartbeatWorkItem(raw json.RawMessage) (any, error) {
+	if s.council == nil {
+		return nil, fmt.Errorf("council store is not available")
+	}
+	var args struct {
+		SessionID  string `json:"session_id"`
+		ItemID     string `json:"item_id"`
+		LeaseToken string `json:"lease_token"`
+		LeaseSec   int    `json:"lease_sec"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.ItemID) == "" || strings.TrimSpace(args.LeaseToken) == "" {
+		return nil, fmt.Errorf("item_id and lease_token are required")
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	lease, err := s.council.renewLease(session.SessionID, strings.TrimSpace(args.ItemID), strings.TrimSpace(args.LeaseToken), leaseDuration(args.LeaseSec), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id": session.SessionID,
+		"item_id":    lease.ItemID,
+		"lease":      lease,
+	}, nil
+}
+
+func (s *MCPServer) toolReleaseWorkItem(raw json.RawMessage) (any, error) {
+	if s.council == nil {
+		return nil, fmt.Errorf("council store is not available")
+	}
+	var args struct {
+		SessionID  string `json:"session_id"`
+		ItemID     string `json:"item_id"`
+		LeaseToken string `json:"lease_token"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.ItemID) == "" || strings.TrimSpace(args.LeaseToken) == "" {
+		return nil, fmt.Errorf("item_id and lease_token are required")
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	released, err := s.council.releaseLease(session.SessionID, strings.TrimSpace(args.ItemID), strings.TrimSpace(args.LeaseToken))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id": session.SessionID,
+		"item_id":    strings.TrimSpace(args.ItemID),
+		"released":   released,
+		"work_items": workItemBoard(session, s.workItemLeases(session.SessionID)),
+		"next_step":  nextAction(session),
+	}, nil
+}
+
 func (s *MCPServer) toolVisualReview(raw json.RawMessage) (any, error) {
 	var args struct {
 		SessionID         string   `json:"session_id"`
@@ -2973,7 +4189,7 @@ func (s *MCPServer) toolVisualReview(raw json.RawMessage) (any, error) {
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepVerifyRun {
-		return nil, fmt.Errorf("visual_review requires verify_run state")
+		return nil, stepGateError(session, "visual_review requires verify_run state", StepVerifyRun)
 	}
 
 	mergeMCPInventory(session, args.AvailableMCPs, args.AvailableMCPTools)
@@ -3072,7 +4288,7 @@ func (s *MCPServer) toolSummarize(raw json.RawMessage) (any, error) {
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	evaluateVisualReviewState(session)
-	if session.Step == StepVerifyRun && session.UserApproved && !visualReviewPending(session) {
+	if session.Step == StepVerifyRun && session.UserApproved && !visualReviewPending(session) && len(unverifiedCriteria(session)) == 0 {
 		session.SetStep(StepSummarized)
 	}
 	gate := "awaiting_user_ok"
@@ -3100,6 +4316,7 @@ func (s *MCPServer) toolSummarize(raw json.RawMessage) (any, error) {
 		"mockup":            session.Mockup,
 		"proposal_accepted": session.ProposalAccepted,
 		"proposal_history":  session.ProposalHistory,
+		"criteria":          session.CriteriaReport,
 		"routing_policy":    session.RoutingPolicy,
 		"council_consensus": session.CouncilConsensus,
 		"council_phase":     session.CouncilPhase,
@@ -3113,6 +4330,10 @@ func (s *MCPServer) toolSummarize(raw json.RawMessage) (any, error) {
 }
 
 func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
+	return s.toolRecordUserFeedbackContext(context.Background(), raw)
+}
+
+func (s *MCPServer) toolRecordUserFeedbackContext(ctx context.Context, raw json.RawMessage) (any, error) {
 	var args struct {
 		SessionID     string   `json:"session_id"`
 		Approved      bool     `json:"approved"`
@@ -3124,11 +4345,30 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 	}
 	session := s.getOrCreateSession(args.SessionID)
 	if session.Step != StepVerifyRun && session.Step != StepSummarized && session.Step != StepMockupReady {
-		return nil, fmt.Errorf("record_user_feedback requires mockup_ready or verify_run or summarized state")
+		return nil, stepGateError(session, "record_user_feedback requires mockup_ready or verify_run or summarized state", StepMockupReady, StepVerifyRun, StepSummarized)
 	}
 	if session.Step == StepVerifyRun && visualReviewPending(session) {
 		return nil, fmt.Errorf("record_user_feedback requires visual_review completion first")
 	}
+	decidedBy := decidedByAgent
+	answer, asked, err := s.elicitUserFeedback(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if asked {
+		if !answer.accepted() {
+			return nil, elicitationDeclined(session, "record_user_feedback", answer)
+		}
+		decidedBy = decidedByUser
+		args.Approved, _ = answer.Content["approved"].(bool)
+		args.Feedback = answer.text("feedback")
+		args.RequiredFixes = answer.lines("required_fixes")
+	}
+	decision := "reject"
+	if args.Approved {
+		decision = "approve"
+	}
+	recordUserDecision(session, "record_user_feedback", decision, decidedBy, args.Feedback)
 	if args.Feedback != "" {
 		session.UserFeedback = append(session.UserFeedback, args.Feedback)
 	}
@@ -3137,6 +4377,7 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 			session.UpdatedAt = time.Now().UTC()
 			return map[string]any{
 				"session_id":    session.SessionID,
+				"decided_by":    decidedBy,
 				"step":          session.Step,
 				"user_approved": true,
 				"next_step":     "approve_plan",
@@ -3145,11 +4386,16 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 		session.FixLoopCount++
 		if args.Feedback != "" {
 			session.PendingReview = append(session.PendingReview, "mockup feedback: "+args.Feedback)
+			notePlanFeedback(session, "mockup feedback: "+args.Feedback)
+		}
+		if version, ok := currentPlanVersion(session); ok {
+			version.Decision = planDecisionRejected
 		}
 		session.SetStep(StepIntentCaptured)
 		session.UpdatedAt = time.Now().UTC()
 		return map[string]any{
 			"session_id":     session.SessionID,
+			"decided_by":     decidedBy,
 			"step":           session.Step,
 			"user_approved":  false,
 			"fix_loop_count": session.FixLoopCount,
@@ -3161,12 +4407,29 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 	session.UserApproved = args.Approved
 
 	if args.Approved {
+		if unverified := unverifiedCriteria(session); session.Step == StepVerifyRun && len(unverified) > 0 {
+			// Verifying again asks for approval again, so the approval is
+			// recorded as a decision but not held.
+			session.UserApproved = false
+			session.LastError = "Success criteria not verified: " + strings.Join(unverified, ", ")
+			session.UpdatedAt = time.Now().UTC()
+			return map[string]any{
+				"session_id":          session.SessionID,
+				"decided_by":          decidedBy,
+				"step":                session.Step,
+				"user_approved":       false,
+				"status":              "criteria_unverified",
+				"unverified_criteria": unverified,
+				"next_step":           "verify_result",
+			}, nil
+		}
 		if session.Step == StepVerifyRun {
 			session.SetStep(StepSummarized)
 		}
 		session.UpdatedAt = time.Now().UTC()
 		return map[string]any{
 			"session_id":    session.SessionID,
+			"decided_by":    decidedBy,
 			"step":          session.Step,
 			"user_approved": true,
 			"next_step":     "done",
@@ -3175,8 +4438,10 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 
 	session.FixLoopCount++
 	session.PendingReview = mergeUniqueStrings(session.PendingReview, args.RequiredFixes...)
+	notePlanFeedback(session, args.RequiredFixes...)
 	if args.Feedback != "" {
 		session.PendingReview = append(session.PendingReview, "User feedback requires updates: "+args.Feedback)
+		notePlanFeedback(session, "User feedback requires updates: "+args.Feedback)
 	}
 	if session.FixLoopCount >= session.MaxFixLoops {
 		session.SetStep(StepFailed)
@@ -3184,6 +4449,7 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 		session.UpdatedAt = time.Now().UTC()
 		return map[string]any{
 			"session_id":     session.SessionID,
+			"decided_by":     decidedBy,
 			"step":           session.Step,
 			"user_approved":  false,
 			"fix_loop_count": session.FixLoopCount,
@@ -3197,6 +4463,7 @@ func (s *MCPServer) toolRecordUserFeedback(raw json.RawMessage) (any, error) {
 	session.UpdatedAt = time.Now().UTC()
 	return map[string]any{
 		"session_id":     session.SessionID,
+		"decided_by":     decidedBy,
 		"step":           session.Step,
 		"user_approved":  false,
 		"fix_loop_count": session.FixLoopCount,
@@ -3258,39 +4525,46 @@ func (s *MCPServer) toolGetSessionStatus(raw json.RawMessage) (any, error) {
 	evaluateVisualReviewState(session)
 	mode, activeSessionID := s.autostartState()
 	return map[string]any{
-		"session_id":           session.SessionID,
-		"step":                 session.Step,
-		"step_history":         session.StepHistory,
-		"next":                 nextAction(session),
-		"proposal_accepted":    session.ProposalAccepted,
-		"proposal_history":     session.ProposalHistory,
-		"council_consensus":    session.CouncilConsensus,
-		"council_phase":        session.CouncilPhase,
-		"plan_approved":        session.PlanApproved,
-		"mockup":               session.Mockup,
-		"user_approved":        session.UserApproved,
-		"requirement_tags":     session.RequirementTags,
-		"approved_criteria":    session.ApprovedCriteria,
-		"user_feedback":        session.UserFeedback,
-		"pending_review":       session.PendingReview,
-		"action_count":         len(session.ActionResults),
-		"verify_count":         len(session.VerifyResults),
-		"fix_loop_count":       session.FixLoopCount,
-		"max_fix_loops":        session.MaxFixLoops,
-		"reconcile_needed":     session.ReconcileNeeded,
-		"baseline_footprint":   session.BaselineFootprint,
-		"last_footprint":       session.LastFootprint,
-		"routing_policy":       session.RoutingPolicy,
-		"council_managers":     session.CouncilManagers,
-		"user_profile":         session.UserProfile,
-		"consultant_lang":      session.ConsultantLang,
-		"available_mcps":       session.AvailableMCPs,
-		"available_mcp_tools":  session.AvailableMCPTools,
-		"visual_review":        session.VisualReview,
-		"last_error":           session.LastError,
-		"autostart_mode":       mode,
-		"autostart_session_id": activeSessionID,
-		"updated_at":           session.UpdatedAt,
+		"session_id":            session.SessionID,
+		"step":                  session.Step,
+		"step_history":          session.StepHistory,
+		"next":                  nextAction(session),
+		"proposal_accepted":     session.ProposalAccepted,
+		"proposal_history":      session.ProposalHistory,
+		"council_consensus":     session.CouncilConsensus,
+		"council_phase":         session.CouncilPhase,
+		"plan_approved":         session.PlanApproved,
+		"plan_versions":         planVersionSummaries(session),
+		"approved_plan_version": session.ApprovedVersion,
+		"mockup":                session.Mockup,
+		"user_approved":         session.UserApproved,
+		"requirement_tags":      session.RequirementTags,
+		"approved_criteria":     session.ApprovedCriteria,
+		"criterion_checks":      session.CriterionChecks,
+		"criteria":              session.CriteriaReport,
+		"user_feedback":         session.UserFeedback,
+		"pending_review":        session.PendingReview,
+		"work_items":            workItemBoard(session, s.workItemLeases(session.SessionID)),
+		"action_count":          len(session.ActionResults),
+		"verify_count":          len(session.VerifyResults),
+		"fix_loop_count":        session.FixLoopCount,
+		"max_fix_loops":         session.MaxFixLoops,
+		"reconcile_needed":      session.ReconcileNeeded,
+		"baseline_footprint":    session.BaselineFootprint,
+		"last_footprint":        session.LastFootprint,
+		"routing_policy":        session.RoutingPolicy,
+		"council_managers":      session.CouncilManagers,
+		"user_profile":          session.UserProfile,
+		"consultant_lang":       session.ConsultantLang,
+		"available_mcps":        session.AvailableMCPs,
+		"available_mcp_tools":   session.AvailableMCPTools,
+		"visual_review":         session.VisualReview,
+		"last_error":            session.LastError,
+		"forked_from":           session.ForkedFrom,
+		"forks":                 session.Forks,
+		"autostart_mode":        mode,
+		"autostart_session_id":  activeSessionID,
+		"updated_at":            session.UpdatedAt,
 	}, nil
 }
 
@@ -3426,6 +4700,10 @@ func classifyFootprintDrift(base RepoFootprint, current RepoFootprint) (string,
 }
 
 func (s *MCPServer) toolReconcileSessionState(raw json.RawMessage) (any, error) {
+	return s.toolReconcileSessionStateContext(context.Background(), raw)
+}
+
+func (s *MCPServer) toolReconcileSessionStateContext(ctx context.Context, raw json.RawMessage) (any, error) {
 	var args struct {
 		SessionID string `json:"session_id"`
 		Mode      string `json:"mode"`
@@ -3446,6 +4724,26 @@ func (s *MCPServer) toolReconcileSessionState(raw json.RawMessage) (any, error)
 	}
 	driftLevel, reason := classifyFootprintDrift(session.BaselineFootprint, current)
 
+	// The keep/restart choice belongs to the user: ask when it is made or
+	// when a check finds high drift, and apply the user's answer.
+	decidedBy := ""
+	if mode == "keep_context" || mode == "restart_context" {
+		decidedBy = decidedByAgent
+	}
+	if decidedBy != "" || (mode == "check" && driftLevel == "high") {
+		answer, asked, err := s.elicitReconcileChoice(ctx, driftLevel, reason)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case asked && answer.accepted() && (answer.text("choice") == "keep_context" || answer.text("choice") == "restart_context"):
+			mode = answer.text("choice")
+			decidedBy = decidedByUser
+		case asked && decidedBy != "":
+			return nil, elicitationDeclined(session, "reconcile_session_state", answer)
+		}
+	}
+
 	switch mode {
 	case "keep_context":
 		session.ReconcileNeeded = false
@@ -3468,10 +4766,14 @@ func (s *MCPServer) toolReconcileSessionState(raw json.RawMessage) (any, error)
 	default:
 		return nil, fmt.Errorf("invalid mode: %s", mode)
 	}
+	if decidedBy != "" {
+		recordUserDecision(session, "reconcile_session_state", mode, decidedBy, reason)
+	}
 
 	session.UpdatedAt = time.Now().UTC()
 	return map[string]any{
 		"session_id":         session.SessionID,
+		"decided_by":         decidedBy,
 		"mode":               mode,
 		"drift_level":        driftLevel,
 		"drift_reason":       reason,
@@ -3605,6 +4907,14 @@ func councilAutonomyPolicy(session *SessionState, role string) (string, string,
 	}
 }
 
+func councilBriefPrompt(session *SessionState, role string) string {
+	autonomy, consultDepth, policyNote := councilAutonomyPolicy(session, role)
+	return fmt.Sprintf(
+		"Project goal: %s\nRole: %s\nAutonomy level: %s\nConsult depth: %s\nPolicy: %s\nBriefing items: (1) top priority (2) role contribution (3) quick decisions to lock (4) additional agenda proposals",
+		strings.TrimSpace(session.Intent.Goal), role, autonomy, consultDepth, policyNote,
+	)
+}
+
 func (s *MCPServer) toolCouncilStartBriefing(raw json.RawMessage) (any, error) {
 	if s.council == nil {
 		return nil, fmt.Errorf("council store is not available")
@@ -3637,7 +4947,7 @@ func (s *MCPServer) toolCouncilStartBriefing(raw json.RawMessage) (any, error) {
 	}
 	ensureCouncilManagerDefaults(session)
 	if session.Step != StepIntentCaptured {
-		return nil, fmt.Errorf("council_start_briefing requires intent_captured state")
+		return nil, stepGateError(session, "council_start_briefing requires intent_captured state", StepIntentCaptured)
 	}
 	if strings.TrimSpace(session.Intent.Goal) == "" {
 		return nil, fmt.Errorf("council_start_briefing requires goal; continue clarify_intent first")
@@ -3660,10 +4970,7 @@ func (s *MCPServer) toolCouncilStartBriefing(raw json.RawMessage) (any, error) {
 			"autonomy_level": autonomy,
 			"consult_depth":  consultDepth,
 			"policy_note":    policyNote,
-			"prompt": fmt.Sprintf(
-				"Project goal: %s\nRole: %s\nAutonomy level: %s\nConsult depth: %s\nPolicy: %s\nBriefing items: (1) top priority (2) role contribution (3) quick decisions to lock (4) additional agenda proposals",
-				strings.TrimSpace(session.Intent.Goal), role.Role, autonomy, consultDepth, policyNote,
-			),
+			"prompt":         councilBriefPrompt(session, role.Role),
 		})
 	}
 
@@ -3988,6 +5295,11 @@ func nextAction(session *SessionState) string {
 	case StepMockupReady:
 		return "approve_plan"
 	case StepPlanApproved:
+		for _, item := range session.WorkItems {
+			if item.Status == itemInProgress {
+				return "verify_result"
+			}
+		}
 		return "run_action"
 	case StepActionExecuted:
 		return "verify_result"
@@ -3995,6 +5307,9 @@ func nextAction(session *SessionState) string {
 		if visualReviewPending(session) {
 			return "visual_review"
 		}
+		if len(unverifiedCriteria(session)) > 0 {
+			return "verify_result"
+		}
 		if session.UserApproved {
 			return "summarize"
 		}
@@ -4039,18 +5354,93 @@ func isAllowedCommand(command string, allowList []string) bool {
 	return false
 }
 
+const (
+	commandStatusOK        = "ok"
+	commandStatusFailed    = "failed"
+	commandStatusTimeout   = "timeout"
+	commandStatusCancelled = "cancelled"
+	commandStatusDryRun    = "dry_run"
+)
+
+// commandWaitDelay bounds how long Wait blocks on output pipes still held by
+// stray descendants after the process group has been killed.
+const commandWaitDelay = 2 * time.Second
+
+func newCommandResult(command, stdout, stderr string, code int, err error, elapsed time.Duration) CommandResult {
+	res := CommandResult{
+		Command:    command,
+		ExitCode:   code,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		DurationMS: elapsed.Milliseconds(),
+		Status:     commandStatusOK,
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		res.Status = commandStatusCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		res.Status = commandStatusTimeout
+	case code != 0 || err != nil:
+		res.Status = commandStatusFailed
+	}
+	return res
+}
+
+// runRedacted runs one command of a run_action or verify_result batch,
+// streaming redacted output as progress, and returns its redacted result.
+// shown is the redacted command for progress messages.
+func (s *MCPServer) runRedacted(ctx context.Context, progress *progressReporter, index, total int, cmd, shown string, timeout time.Duration) CommandResult {
+	start := time.Now()
+	r := s.redactor.forCommand(cmd)
+	var stdoutStream, stderrStream io.Writer
+	stdoutProgress, stderrProgress := progress.commandOutput(index, total, shown)
+	stdoutRedacted, stderrRedacted := r.stream(stdoutProgress), r.stream(stderrProgress)
+	if stdoutRedacted != nil {
+		stdoutStream, stderrStream = stdoutRedacted, stderrRedacted
+	}
+	stdout, stderr, code, err := runCommandStreaming(ctx, cmd, s.cfg.WorkDir, timeout, stdoutStream, stderrStream)
+	stdoutRedacted.flush()
+	stderrRedacted.flush()
+	return s.redactor.redactResult(newCommandResult(cmd, stdout, stderr, code, err, time.Since(start)))
+}
+
 func runCommandWithTimeout(ctx context.Context, command string, dir string, timeoutSeconds time.Duration) (string, string, int, error) {
+	return runCommandStreaming(ctx, command, dir, timeoutSeconds, nil, nil)
+}
+
+// runCommandStreaming is runCommandWithTimeout that additionally copies
+// output to the given writers as it is produced. Nil writers are ignored.
+func runCommandStreaming(ctx context.Context, command string, dir string, timeoutSeconds time.Duration, stdoutStream, stderrStream io.Writer) (string, string, int, error) {
 	ctx2, cancel := context.WithTimeout(ctx, timeoutSeconds*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx2, "sh", "-c", command)
 	if dir != "" {
 		cmd.Dir = dir
 	}
+	// Run in a dedicated process group so cancellation also reaps children
+	// of `sh -c` (e.g. test binaries spawned by go test).
+	setProcessGroupKill(cmd)
+	cmd.WaitDelay = commandWaitDelay
 	var outb bytes.Buffer
 	var errb bytes.Buffer
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
+	if stdoutStream != nil {
+		cmd.Stdout = io.MultiWriter(&outb, stdoutStream)
+	}
+	if stderrStream != nil {
+		cmd.Stderr = io.MultiWriter(&errb, stderrStream)
+	}
 	err := cmd.Run()
+	if ctx.Err() != nil {
+		return outb.String(), errb.String(), -1, fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
+	if errors.Is(ctx2.Err(), context.DeadlineExceeded) {
+		return outb.String(), errb.String(), -1, fmt.Errorf("command timed out after %s: %w", timeoutSeconds*time.Second, context.DeadlineExceeded)
+	}
 	if exitErr, ok := err.(*exec.ExitError); ok {
 		return outb.String(), errb.String(), exitErr.ExitCode(), err
 	}
@@ -4276,6 +5666,311 @@ func (s *MCPServer) toolGitRecoverState(raw json.RawMessage) (any, error) {
 	}
 }
 
+func (s *MCPServer) toolListSessions(raw json.RawMessage) (any, error) {
+	var args struct {
+		Query         string   `json:"query"`
+		Step          string   `json:"step"`
+		Goal          string   `json:"goal"`
+		Branch        string   `json:"branch"`
+		Tags          []string `json:"tags"`
+		UpdatedAfter  string   `json:"updated_after"`
+		UpdatedBefore string   `json:"updated_before"`
+		Limit         int      `json:"limit"`
+		Offset        int      `json:"offset"`
+		Archived      bool     `json:"archived"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	filter := SessionFilter{
+		Step:   strings.TrimSpace(args.Step),
+		Goal:   strings.TrimSpace(args.Goal),
+		Query:  strings.TrimSpace(args.Query),
+		Branch: strings.TrimSpace(args.Branch),
+		Tags:   args.Tags,
+		Offset: args.Offset,
+		Limit:  args.Limit,
+	}
+	var err error
+	if filter.UpdatedAfter, err = ParseSessionTime("updated_after", args.UpdatedAfter); err != nil {
+		return nil, err
+	}
+	if filter.UpdatedBefore, err = ParseSessionTime("updated_before", args.UpdatedBefore); err != nil {
+		return nil, err
+	}
+	if args.Archived {
+		page, err := s.ListArchivedSessions(filter)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"sessions":    page.Sessions,
+			"total":       page.Total,
+			"next_offset": page.NextOffset,
+		}, nil
+	}
+	// Writing also picks up sessions other processes stored.
+	if err := s.persistSessions(); err != nil && !errors.Is(err, errSessionStoreUnavailable) {
+		s.logger.Warn("refreshing sessions before listing failed", "error", err)
+	}
+	page := s.ListSessions(filter)
+	return map[string]any{
+		"sessions":    page.Sessions,
+		"total":       page.Total,
+		"next_offset": page.NextOffset,
+	}, nil
+}
+
+func (s *MCPServer) toolForkSession(raw json.RawMessage) (any, error) {
+	var args struct {
+		SessionID    string `json:"session_id"`
+		NewSessionID string `json:"new_session_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if !s.hasSession(args.SessionID) {
+		return nil, fmt.Errorf("unknown session %q", args.SessionID)
+	}
+	parent := s.getOrCreateSession(args.SessionID)
+	childID := strings.TrimSpace(args.NewSessionID)
+	if childID == "" {
+		childID = randomID()
+	}
+	if err := checkSessionIDPath(childID); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, errSessionStoreUnavailable
+	}
+	if childID == parent.SessionID {
+		return nil, fmt.Errorf("session %q already exists", childID)
+	}
+
+	// A JSON round trip deep-copies every field the session persists.
+	encoded, err := json.Marshal(parent)
+	if err != nil {
+		return nil, err
+	}
+	child := &SessionState{}
+	if err := json.Unmarshal(encoded, child); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	child.SessionID = childID
+	child.ForkedFrom = parent.SessionID
+	child.Forks = nil
+	child.CreatedAt = now
+	child.UpdatedAt = now
+
+	// installSessionNow checks under the state lock that no process has a
+	// session with the child's ID. The council rows are copied before the
+	// snapshot so it includes them.
+	lock := s.sessionLock(childID)
+	lock.Lock()
+	defer lock.Unlock()
+	err = s.installSessionNow(child, func() error {
+		if err := s.council.copySessionRows(parent.SessionID, childID); err != nil {
+			return err
+		}
+		return s.captureSnapshot(child, "fork_session")
+	})
+	if err != nil {
+		return nil, err
+	}
+	parent.Forks = append(parent.Forks, childID)
+	parent.UpdatedAt = now
+
+	return map[string]any{
+		"session_id":  child.SessionID,
+		"forked_from": child.ForkedFrom,
+		"forks":       parent.Forks,
+		"step":        child.Step,
+	}, nil
+}
+
+func (s *MCPServer) toolRewindSession(raw json.RawMessage) (any, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Snapshot  *int   `json:"snapshot"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if !s.hasSession(args.SessionID) {
+		return nil, fmt.Errorf("unknown session %q", args.SessionID)
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	if args.Snapshot == nil {
+		return map[string]any{
+			"session_id": session.SessionID,
+			"step":       session.Step,
+			"snapshots":  summarizeSnapshots(session),
+		}, nil
+	}
+	index := *args.Snapshot
+	if index < 0 || index >= len(session.Snapshots) {
+		return nil, &toolFailure{
+			SessionID: session.SessionID,
+			Step:      session.Step,
+			Reason:    fmt.Sprintf("snapshot %d does not exist; the session has %d snapshots", index, len(session.Snapshots)),
+		}
+	}
+	if err := s.rewindSession(session, session.Snapshots[index]); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id":   session.SessionID,
+		"rewound_to":   index,
+		"step":         session.Step,
+		"step_history": session.StepHistory,
+		"snapshots":    summarizeSnapshots(session),
+	}, nil
+}
+
+func (s *MCPServer) toolArchiveSession(raw json.RawMessage) (any, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if !s.hasSession(args.SessionID) {
+		return nil, fmt.Errorf("unknown session %q", args.SessionID)
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	reason := strings.TrimSpace(args.Reason)
+	if reason == "" {
+		reason = "archive_session"
+	}
+	path, err := s.archiveSession(session, reason)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id": args.SessionID,
+		"archived":   true,
+		"archive":    path,
+	}, nil
+}
+
+func (s *MCPServer) toolRestoreSession(raw json.RawMessage) (any, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if s.hasSession(args.SessionID) {
+		return nil, fmt.Errorf("session %q already exists", args.SessionID)
+	}
+	session, err := s.restoreArchivedSession(args.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id": session.SessionID,
+		"restored":   true,
+		"step":       session.Step,
+		"snapshots":  len(session.Snapshots),
+	}, nil
+}
+
+func (s *MCPServer) toolExportSession(raw json.RawMessage) (any, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Path      string `json:"path"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if !s.hasSession(args.SessionID) {
+		return nil, fmt.Errorf("unknown session %q", args.SessionID)
+	}
+	session := s.getOrCreateSession(args.SessionID)
+	path := strings.TrimSpace(args.Path)
+	if path == "" {
+		path = s.defaultExportPath(session.SessionID)
+	}
+	skipped, err := s.exportSession(session, path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id":        session.SessionID,
+		"path":              path,
+		"artifacts":         len(session.VisualReview.Artifacts) - len(skipped),
+		"skipped_artifacts": skipped,
+	}, nil
+}
+
+func (s *MCPServer) toolImportSession(raw json.RawMessage) (any, error) {
+	var args struct {
+		Path         string `json:"path"`
+		NewSessionID string `json:"new_session_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	bundle, payload, session, err := readSessionExport(strings.TrimSpace(args.Path))
+	if err != nil {
+		return nil, err
+	}
+	newID := strings.TrimSpace(args.NewSessionID)
+	if newID == "" {
+		newID = session.SessionID
+		if s.hasSession(newID) {
+			newID = randomID()
+		}
+	}
+
+	lock := s.sessionLock(newID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := s.importSession(session, payload, newID); err != nil {
+		return nil, err
+	}
+	if err := s.captureSnapshot(session, "import_session"); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"session_id":        session.SessionID,
+		"source_session_id": bundle.SourceSessionID,
+		"step":              session.Step,
+		"artifacts":         len(payload.Artifacts),
+	}, nil
+}
+
+func (s *MCPServer) toolStateRecover(raw json.RawMessage) (any, error) {
+	var args struct {
+		Backup string `json:"backup"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(args.Backup)
+	if name == "" {
+		backups, err := ListStateBackups(s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"backups": backups}, nil
+	}
+	safety, err := s.restoreState(name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	count := len(s.sessions)
+	s.mu.Unlock()
+	return map[string]any{
+		"restored":      name,
+		"safety_backup": filepath.Base(safety),
+		"sessions":      count,
+	}, nil
+}
+
 func gitCommand(dir string, args ...string) (string, string, error) {
 	cmd := exec.Command("git", args...)
 	if dir != "" {
@@ -3,6 +3,7 @@ package server
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -31,15 +32,36 @@ type Intent struct {
 	Assumptions      []string `json:"assumptions"`
 }
 
+// Plan is one generated plan. Version numbers the plans of a session,
+// starting at 1.
 type Plan struct {
-	Title       string   `json:"title"`
-	Steps       []string `json:"steps"`
-	Assumptions []string `json:"assumptions"`
-	Risks       []string `json:"risks"`
+	Version     int        `json:"version"`
+	Title       string     `json:"title"`
+	Items       []PlanItem `json:"items"`
+	Assumptions []string   `json:"assumptions"`
+	Risks       []string   `json:"risks"`
 }
 
+// PlanItem is one unit of work in a plan. Owner is a council manager or
+// worker role; DependsOn names items that must be done first.
+type PlanItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Owner string `json:"owner"`
+	// Files are glob patterns of the files the item is expected to change.
+	Files []string `json:"files"`
+	// Verify are commands that check the item once it is done.
+	Verify          []string `json:"verify"`
+	RequirementTags []string `json:"requirement_tags"`
+	// Criteria are the success criteria the item delivers.
+	Criteria  []string `json:"criteria"`
+	DependsOn []string `json:"depends_on"`
+}
+
+// MockupArtifact illustrates the plan version PlanVersion.
 type MockupArtifact struct {
 	Version       int       `json:"version"`
+	PlanVersion   int       `json:"plan_version"`
 	Summary       string    `json:"summary"`
 	KeyFlows      []string  `json:"key_flows"`
 	OpenQuestions []string  `json:"open_questions"`
@@ -103,31 +125,96 @@ type VisualReviewState struct {
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+// UserDecision is one answer at an approval gate. DecidedBy is "user" when
+// the human answered through elicitation and "agent" when it was relayed in
+// tool arguments. PlanVersion is the plan an approve_plan answer was about.
+type UserDecision struct {
+	Gate        string    `json:"gate"`
+	Decision    string    `json:"decision"`
+	DecidedBy   string    `json:"decided_by"`
+	Notes       string    `json:"notes,omitempty"`
+	PlanVersion int       `json:"plan_version,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// PlanVersion is one generated plan, the mockup made for it and the
+// feedback that led to it. Feedback is gathered in SessionState.PlanFeedback
+// as plans are rejected, until the next version records it. Decision is
+// "approved" or "rejected" once approve_plan has ruled on the version.
+type PlanVersion struct {
+	Version   int             `json:"version"`
+	Plan      Plan            `json:"plan"`
+	Mockup    *MockupArtifact `json:"mockup"`
+	Feedback  []string        `json:"feedback"`
+	Decision  string          `json:"decision,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// CriterionCheck binds an approved success criterion to a verification
+// command. The check passes when the command exits with ExpectExitCode and
+// its output contains every OutputContains entry and no OutputExcludes one.
+type CriterionCheck struct {
+	Criterion      string   `json:"criterion"`
+	Command        string   `json:"command"`
+	ExpectExitCode int      `json:"expect_exit_code"`
+	OutputContains []string `json:"output_contains"`
+	OutputExcludes []string `json:"output_excludes"`
+}
+
+// CriterionResult is the verification outcome of one approved criterion:
+// pass, fail, or unverified when none of its checks ran.
+type CriterionResult struct {
+	Criterion string        `json:"criterion"`
+	Status    string        `json:"status"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Command        string `json:"command"`
+	ExpectExitCode int    `json:"expect_exit_code"`
+	ExitCode       int    `json:"exit_code"`
+	Passed         bool   `json:"passed"`
+	Reason         string `json:"reason,omitempty"`
+}
+
 type CommandResult struct {
 	Command    string `json:"command"`
 	ExitCode   int    `json:"exit_code"`
 	Stdout     string `json:"stdout"`
 	Stderr     string `json:"stderr"`
 	DurationMS int64  `json:"duration_ms"`
+	Status     string `json:"status,omitempty"`
 	Error      string `json:"error,omitempty"`
+	// Redactions counts the secrets removed from the fields above.
+	Redactions int `json:"redactions"`
+	// ItemID is the plan item the command ran for, if any.
+	ItemID string `json:"item_id,omitempty"`
 }
 
 type SessionState struct {
 	SessionID         string               `json:"session_id"`
+	SchemaVersion     int                  `json:"schema_version"`
 	Step              WorkStep             `json:"step"`
 	StepHistory       []WorkStep           `json:"step_history"`
 	Intent            Intent               `json:"intent"`
 	Plan              *Plan                `json:"plan"`
 	Mockup            *MockupArtifact      `json:"mockup"`
+	PlanVersions      []PlanVersion        `json:"plan_versions"`
+	PlanFeedback      []string             `json:"plan_feedback"`
 	ProposalHistory   []ConsultProposal    `json:"proposal_history"`
 	ProposalAccepted  bool                 `json:"proposal_accepted"`
 	CouncilConsensus  bool                 `json:"council_consensus"`
 	CouncilPhase      string               `json:"council_phase"`
 	RequirementTags   []string             `json:"requirement_tags"`
 	ApprovedCriteria  []string             `json:"approved_criteria"`
+	CriterionChecks   []CriterionCheck     `json:"criterion_checks"`
+	CriteriaReport    []CriterionResult    `json:"criteria_report"`
 	PlanApproved      bool                 `json:"plan_approved"`
+	ApprovedVersion   int                  `json:"approved_plan_version"`
+	WorkItems         []WorkItemState      `json:"work_items"`
 	UserApproved      bool                 `json:"user_approved"`
 	UserFeedback      []string             `json:"user_feedback"`
+	UserDecisions     []UserDecision       `json:"user_decisions"`
 	FixLoopCount      int                  `json:"fix_loop_count"`
 	MaxFixLoops       int                  `json:"max_fix_loops"`
 	ActionResults     []CommandResult      `json:"action_results"`
@@ -147,8 +234,26 @@ type SessionState struct {
 	VisualReview      VisualReviewState    `json:"visual_review"`
 	LastError         string               `json:"last_error"`
 	AllowedDomains    []string             `json:"allowed_domains"`
+	ForkedFrom        string               `json:"forked_from"`
+	Forks             []string             `json:"forks"`
 	CreatedAt         time.Time            `json:"created_at"`
 	UpdatedAt         time.Time            `json:"updated_at"`
+	// Snapshots are stored in their own table and left out of the session
+	// JSON, which each snapshot embeds.
+	Snapshots []SessionSnapshot `json:"-"`
+	// transitions counts step changes in memory, so a tool call can tell
+	// whether it moved the session.
+	transitions int
+}
+
+// SessionSnapshot is the full session state, and the session's council
+// rows, captured after a tool call changed the step.
+type SessionSnapshot struct {
+	Step    WorkStep        `json:"step"`
+	Reason  string          `json:"reason"`
+	State   json.RawMessage `json:"state"`
+	Council json.RawMessage `json:"council"`
+	At      time.Time       `json:"at"`
 }
 
 func NewSession() *SessionState {
@@ -156,6 +261,7 @@ func NewSession() *SessionState {
 	now := time.Now().UTC()
 	return &SessionState{
 		SessionID:      id,
+		SchemaVersion:  sessionSchemaVersion,
 		Step:           StepReceived,
 		StepHistory:    []WorkStep{StepReceived},
 		MaxFixLoops:    5,
@@ -182,9 +288,14 @@ func NewSession() *SessionState {
 			Confidence:      0.2,
 			Evidence:        []string{},
 		},
-		ConsultantLang: "en",
+		ConsultantLang:    "en",
+		AvailableMCPs:     []string{},
+		AvailableMCPTools: []string{},
 		VisualReview: VisualReviewState{
-			Status: "not_required",
+			Status:          "not_required",
+			RendererMatches: []string{},
+			Artifacts:       []string{},
+			Findings:        []string{},
 		},
 		CreatedAt: now,
 		UpdatedAt: now,
@@ -198,6 +309,7 @@ func (s *SessionState) SetStep(next WorkStep) {
 	if s.Step != next {
 		s.Step = next
 		s.StepHistory = append(s.StepHistory, next)
+		s.transitions++
 		return
 	}
 	s.Step = next
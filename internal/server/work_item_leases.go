@@ -0,0 +1,158 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultLeaseDuration = 5 * time.Minute
+	maxLeaseDuration     = time.Hour
+)
+
+// workItemLease is a worker's claim on a plan item. A lease that is not
+// renewed before it expires lapses, and the item can be claimed again.
+type workItemLease struct {
+	ItemID    string    `json:"item_id"`
+	Worker    string    `json:"worker"`
+	Token     string    `json:"lease_token"`
+	ClaimedAt time.Time `json:"claimed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// leaseDuration turns a lease_sec argument into a lease length.
+func leaseDuration(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultLeaseDuration
+	}
+	d := time.Duration(seconds) * time.Second
+	if d > maxLeaseDuration {
+		return maxLeaseDuration
+	}
+	return d
+}
+
+// activeLeases returns the unexpired leases of a session by item.
+func (c *councilStore) activeLeases(sessionID string, now time.Time) (map[string]workItemLease, error) {
+	rows, err := c.db.Query(`SELECT item_id,worker,token,claimed_at,expires_at FROM work_item_leases
+		WHERE session_id=? AND expires_at>?`, sessionID, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]workItemLease{}
+	for rows.Next() {
+		var lease workItemLease
+		var claimedAt string
+		var expiresAt int64
+		if err := rows.Scan(&lease.ItemID, &lease.Worker, &lease.Token, &claimedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		lease.ClaimedAt = parseTimeOrZero(claimedAt)
+		lease.ExpiresAt = time.UnixMilli(expiresAt).UTC()
+		out[lease.ItemID] = lease
+	}
+	return out, rows.Err()
+}
+
+// claimLease takes an item for a worker unless another worker holds an
+// unexpired lease on it. The upsert is a single statement, so processes
+// sharing the database cannot both win the same item.
+func (c *councilStore) claimLease(sessionID, itemID, worker string, ttl time.Duration, now time.Time) (workItemLease, bool, error) {
+	lease := workItemLease{
+		ItemID:    itemID,
+		Worker:    worker,
+		Token:     randomID(),
+		ClaimedAt: now.UTC(),
+		ExpiresAt: now.Add(ttl).UTC(),
+	}
+	res, err := execRetry(c.db, `INSERT INTO work_item_leases(session_id,item_id,worker,token,claimed_at,expires_at) VALUES(?,?,?,?,?,?)
+		ON CONFLICT(session_id,item_id) DO UPDATE SET
+			worker=excluded.worker, token=excluded.token, claimed_at=excluded.claimed_at, expires_at=excluded.expires_at
+		WHERE work_item_leases.expires_at<=?`,
+		sessionID, itemID, worker, lease.Token, lease.ClaimedAt.Format(time.RFC3339Nano), lease.ExpiresAt.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return workItemLease{}, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return workItemLease{}, false, err
+	}
+	return lease, n == 1, nil
+}
+
+var errLeaseNotHeld = errors.New("lease is not held: it expired, was released or was taken over; claim the item again")
+
+// renewLease extends a lease the caller still holds.
+func (c *councilStore) renewLease(sessionID, itemID, token string, ttl time.Duration, now time.Time) (workItemLease, error) {
+	res, err := execRetry(c.db, `UPDATE work_item_leases SET expires_at=?
+		WHERE session_id=? AND item_id=? AND token=? AND expires_at>?`,
+		now.Add(ttl).UnixMilli(), sessionID, itemID, token, now.UnixMilli())
+	if err != nil {
+		return workItemLease{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return workItemLease{}, err
+	} else if n == 0 {
+		return workItemLease{}, fmt.Errorf("work item %q: %w", itemID, errLeaseNotHeld)
+	}
+	leases, err := c.activeLeases(sessionID, now)
+	if err != nil {
+		return workItemLease{}, err
+	}
+	return leases[itemID], nil
+}
+
+// releaseLease drops a lease. An empty token drops it whoever holds it,
+// which is how a finished item gives up its lease.
+func (c *councilStore) releaseLease(sessionID, itemID, token string) (bool, error) {
+	var res sql.Result
+	var err error
+	if token == "" {
+		res, err = execRetry(c.db, `DELETE FROM work_item_leases WHERE session_id=? AND item_id=?`, sessionID, itemID)
+	} else {
+		res, err = execRetry(c.db, `DELETE FROM work_item_leases WHERE session_id=? AND item_id=? AND token=?`, sessionID, itemID, token)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// releaseSessionLeases drops every lease of a session, for a newly
+// approved plan.
+func (c *councilStore) releaseSessionLeases(sessionID string) error {
+	_, err := execRetry(c.db, `DELETE FROM work_item_leases WHERE session_id=?`, sessionID)
+	return err
+}
+
+// workItemLeases returns a session's live leases, or none when the store is
+// unavailable.
+func (s *MCPServer) workItemLeases(sessionID string) map[string]workItemLease {
+	if s.council == nil {
+		return nil
+	}
+	leases, err := s.council.activeLeases(sessionID, time.Now())
+	if err != nil {
+		s.logger.Warn("loading work item leases failed", "session_id", sessionID, "error", err)
+		return nil
+	}
+	return leases
+}
+
+// checkItemLease refuses work on an item leased to another worker.
+func (s *MCPServer) checkItemLease(session *SessionState, itemID, token, tool string) error {
+	lease, ok := s.workItemLeases(session.SessionID)[itemID]
+	if !ok || lease.Token == token {
+		return nil
+	}
+	return &toolFailure{
+		SessionID: session.SessionID,
+		Step:      session.Step,
+		NextStep:  tool,
+		Reason:    fmt.Sprintf("work item %q is leased to %s until %s; pass its lease_token or claim another item", itemID, lease.Worker, lease.ExpiresAt.Format(time.RFC3339)),
+	}
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Work item states. Blocked items wait on dependencies that are not done;
+// in_progress items ran their action and await verification.
+const (
+	itemPending    = "pending"
+	itemInProgress = "in_progress"
+	itemDone       = "done"
+	itemFailed     = "failed"
+	itemBlocked    = "blocked"
+)
+
+// WorkItemState tracks execution of one plan item after approval.
+type WorkItemState struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// workItemRow is one line of the progress board.
+type workItemRow struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	Owner         string   `json:"owner"`
+	Status        string   `json:"status"`
+	DependsOn     []string `json:"depends_on"`
+	BlockedBy     []string `json:"blocked_by"`
+	Attempts      int      `json:"attempts"`
+	Actions       int      `json:"actions"`
+	Verifications int      `json:"verifications"`
+	LastError     string   `json:"last_error,omitempty"`
+	// Lease is the worker currently holding the item, if any.
+	Lease *workItemLease `json:"lease,omitempty"`
+}
+
+// startWorkItems gives every item of the approved plan a fresh state.
+func startWorkItems(session *SessionState) {
+	session.WorkItems = nil
+	if session.Plan == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for _, item := range session.Plan.Items {
+		session.WorkItems = append(session.WorkItems, WorkItemState{ID: item.ID, Status: itemPending, UpdatedAt: now})
+	}
+	refreshWorkItems(session)
+}
+
+// workItem returns the state and plan entry of an item.
+func workItem(session *SessionState, id string) (*WorkItemState, PlanItem, bool) {
+	if session.Plan == nil {
+		return nil, PlanItem{}, false
+	}
+	for i := range session.WorkItems {
+		if session.WorkItems[i].ID != id {
+			continue
+		}
+		for _, item := range session.Plan.Items {
+			if item.ID == id {
+				return &session.WorkItems[i], item, true
+			}
+		}
+	}
+	return nil, PlanItem{}, false
+}
+
+// unfinishedDependencies lists the dependencies of an item that are not
+// done.
+func unfinishedDependencies(session *SessionState, item PlanItem) []string {
+	status := map[string]string{}
+	for _, state := range session.WorkItems {
+		status[state.ID] = state.Status
+	}
+	out := []string{}
+	for _, dep := range item.DependsOn {
+		if status[dep] != itemDone {
+			out = append(out, dep)
+		}
+	}
+	return out
+}
+
+// refreshWorkItems moves waiting items between pending and blocked as
+// their dependencies finish or fail.
+func refreshWorkItems(session *SessionState) {
+	if session.Plan == nil {
+		return
+	}
+	for _, item := range session.Plan.Items {
+		state, _, ok := workItem(session, item.ID)
+		if !ok || (state.Status != itemPending && state.Status != itemBlocked) {
+			continue
+		}
+		if len(unfinishedDependencies(session, item)) > 0 {
+			state.Status = itemBlocked
+		} else {
+			state.Status = itemPending
+		}
+	}
+}
+
+func setWorkItemStatus(state *WorkItemState, status, lastError string) {
+	state.Status = status
+	state.LastError = lastError
+	state.UpdatedAt = time.Now().UTC()
+}
+
+func allWorkItemsDone(session *SessionState) bool {
+	for _, state := range session.WorkItems {
+		if state.Status != itemDone {
+			return false
+		}
+	}
+	return true
+}
+
+// workItemReady reports whether an item can be picked up: its dependencies
+// are done and it is not done itself. An in_progress item whose worker went
+// away is ready again once its lease lapses.
+func workItemReady(state *WorkItemState) bool {
+	return state.Status == itemPending || state.Status == itemFailed || state.Status == itemInProgress
+}
+
+// nextWorkItem returns the first item in dependency order that can run and
+// is not leased, or "" when none can.
+func nextWorkItem(session *SessionState, leases map[string]workItemLease) string {
+	if session.Plan == nil {
+		return ""
+	}
+	for _, id := range planItemOrder(session.Plan.Items) {
+		if _, leased := leases[id]; leased {
+			continue
+		}
+		if state, _, ok := workItem(session, id); ok && workItemReady(state) {
+			return id
+		}
+	}
+	return ""
+}
+
+// workItemBoard summarizes item progress and leases for status output.
+func workItemBoard(session *SessionState, leases map[string]workItemLease) map[string]any {
+	counts := map[string]int{itemPending: 0, itemInProgress: 0, itemDone: 0, itemFailed: 0, itemBlocked: 0}
+	leased := 0
+	rows := []workItemRow{}
+	if session.Plan != nil {
+		actions, verifications := map[string]int{}, map[string]int{}
+		for _, res := range session.ActionResults {
+			actions[res.ItemID]++
+		}
+		for _, res := range session.VerifyResults {
+			verifications[res.ItemID]++
+		}
+		for _, item := range session.Plan.Items {
+			state, _, ok := workItem(session, item.ID)
+			if !ok {
+				continue
+			}
+			row := workItemRow{
+				ID:            item.ID,
+				Title:         item.Title,
+				Owner:         item.Owner,
+				Status:        state.Status,
+				DependsOn:     item.DependsOn,
+				BlockedBy:     []string{},
+				Attempts:      state.Attempts,
+				Actions:       actions[item.ID],
+				Verifications: verifications[item.ID],
+				LastError:     state.LastError,
+			}
+			if state.Status == itemBlocked {
+				row.BlockedBy = unfinishedDependencies(session, item)
+			}
+			if lease, ok := leases[item.ID]; ok {
+				row.Lease = &lease
+				leased++
+			}
+			counts[state.Status]++
+			rows = append(rows, row)
+		}
+	}
+	return map[string]any{
+		"items":     rows,
+		"counts":    counts,
+		"total":     len(rows),
+		"leased":    leased,
+		"next_item": nextWorkItem(session, leases),
+	}
+}
+
+// selectWorkItem resolves the item a run_action or verify_result call
+// targets. Without an item ID the call covers the whole plan, which is only
+// allowed while at most one item is being tracked.
+func selectWorkItem(session *SessionState, itemID, tool string) (*WorkItemState, PlanItem, error) {
+	if itemID == "" {
+		if len(session.WorkItems) > 1 {
+			return nil, PlanItem{}, &toolFailure{
+				SessionID: session.SessionID,
+				Step:      session.Step,
+				NextStep:  tool,
+				Reason:    fmt.Sprintf("item_id is required: the plan has %d work items; next ready item is %q", len(session.WorkItems), nextWorkItem(session, nil)),
+			}
+		}
+		if len(session.WorkItems) == 1 {
+			state, item, _ := workItem(session, session.WorkItems[0].ID)
+			return state, item, nil
+		}
+		return nil, PlanItem{}, nil
+	}
+	state, item, ok := workItem(session, itemID)
+	if !ok {
+		return nil, PlanItem{}, fmt.Errorf("unknown work item %q", itemID)
+	}
+	return state, item, nil
+}
+
+// verifyWorkItem runs the checks of one item that has run its action. A
+// failing check marks only that item failed; once every item is done the
+// session moves to action_executed for the final verification.
+func (s *MCPServer) verifyWorkItem(ctx context.Context, session *SessionState, itemID, leaseToken string, cmds []string, timeout time.Duration) (any, error) {
+	if session.Step != StepPlanApproved {
+		return nil, stepGateError(session, "verify_result with item_id requires plan_approved state", StepPlanApproved)
+	}
+	item, planItem, err := selectWorkItem(session, itemID, "verify_result")
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != itemInProgress {
+		return nil, &toolFailure{
+			SessionID: session.SessionID,
+			Step:      session.Step,
+			NextStep:  "run_action",
+			Reason:    fmt.Sprintf("work item %q is %s; run_action for it first", item.ID, item.Status),
+		}
+	}
+	if err := s.checkItemLease(session, item.ID, leaseToken, "verify_result"); err != nil {
+		return nil, err
+	}
+	if len(cmds) == 0 {
+		cmds = planItem.Verify
+	}
+	if len(cmds) == 0 {
+		cmds = []string{"go test ./..."}
+	}
+	for _, cmd := range cmds {
+		if !isAllowedCommand(cmd, s.cfg.AllowedCommands) {
+			return nil, fmt.Errorf("command not allowed: %s", cmd)
+		}
+	}
+
+	session, item, results, err := s.runItemCommands(ctx, session, item.ID, cmds, timeout)
+	if err != nil {
+		return nil, err
+	}
+	session.VerifyResults = append(session.VerifyResults, results...)
+	result := func(extra map[string]any) map[string]any {
+		out := map[string]any{
+			"session_id": session.SessionID,
+			"step":       session.Step,
+			"item_id":    item.ID,
+			"results":    session.VerifyResults,
+			"work_items": workItemBoard(session, s.workItemLeases(session.SessionID)),
+			"next_step":  nextAction(session),
+		}
+		for k, v := range extra {
+			out[k] = v
+		}
+		return out
+	}
+	last := results[len(results)-1]
+	if last.Status == commandStatusCancelled {
+		session.LastError = "verify_result cancelled by client"
+		session.UpdatedAt = time.Now().UTC()
+		return result(map[string]any{"status": commandStatusCancelled, "error": session.LastError}), nil
+	}
+	if last.ExitCode != 0 {
+		setWorkItemStatus(item, itemFailed, last.Error)
+		session.LastError = last.Error
+		session.PendingReview = append(session.PendingReview, fmt.Sprintf("Verification failed for item %s (%s): %s", item.ID, last.Command, last.Error))
+		refreshWorkItems(session)
+		session.UpdatedAt = time.Now().UTC()
+		return result(map[string]any{"error": last.Error}), nil
+	}
+	setWorkItemStatus(item, itemDone, "")
+	if s.council != nil {
+		if _, err := s.council.releaseLease(session.SessionID, item.ID, ""); err != nil {
+			s.logger.Warn("releasing lease of finished work item failed", "session_id", session.SessionID, "item_id", item.ID, "error", err)
+		}
+	}
+	refreshWorkItems(session)
+	session.LastError = ""
+	if allWorkItemsDone(session) {
+		session.SetStep(StepActionExecuted)
+	}
+	session.UpdatedAt = time.Now().UTC()
+	return result(nil), nil
+}
+
+// runWorkItemAction runs the action commands of one item and records their
+// outcome on that item alone; the session stays at plan_approved.
+func (s *MCPServer) runWorkItemAction(ctx context.Context, session *SessionState, itemID, previousStatus string, cmds []string, timeout time.Duration) (any, error) {
+	session, item, results, err := s.runItemCommands(ctx, session, itemID, cmds, timeout)
+	if err != nil {
+		return nil, err
+	}
+	session.ActionResults = append(session.ActionResults, results...)
+	out := map[string]any{"session_id": session.SessionID, "item_id": itemID}
+	switch last := results[len(results)-1]; {
+	case last.Status == commandStatusCancelled:
+		// The item goes back to where it was so it can be re-run
+		// deliberately.
+		setWorkItemStatus(item, previousStatus, item.LastError)
+		session.LastError = "run_action cancelled by client"
+		out["status"] = commandStatusCancelled
+		out["error"] = session.LastError
+	case last.ExitCode != 0:
+		// A failed item is retried on its own; the session keeps the
+		// other items' progress.
+		setWorkItemStatus(item, itemFailed, last.Error)
+		session.LastError = last.Error
+		out["error"] = last.Error
+	}
+	session.UpdatedAt = time.Now().UTC()
+	out["step"] = session.Step
+	out["results"] = session.ActionResults
+	out["work_items"] = workItemBoard(session, s.workItemLeases(session.SessionID))
+	out["next_step"] = nextAction(session)
+	return out, nil
+}
+
+// runItemCommands runs an item's commands in order, stopping at the first
+// that fails or is cancelled. The session lock is released meanwhile, so the
+// items of a session run in parallel. It returns the session and item as
+// they are once the commands finished, for the caller to merge only this
+// item's status and results into.
+func (s *MCPServer) runItemCommands(ctx context.Context, session *SessionState, itemID string, cmds []string, timeout time.Duration) (*SessionState, *WorkItemState, []CommandResult, error) {
+	results := []CommandResult{}
+	session, err := s.unlockedDuring(ctx, session.SessionID, func() {
+		progress := progressFromContext(ctx)
+		for i, cmd := range cmds {
+			shown, _ := s.redactor.forCommand(cmd).redact(cmd)
+			progress.commandStarted(i, len(cmds), shown)
+			res := s.runRedacted(ctx, progress, i, len(cmds), cmd, shown, timeout)
+			res.ItemID = itemID
+			results = append(results, res)
+			progress.commandFinished(i, len(cmds), res)
+			if res.Status == commandStatusCancelled || res.ExitCode != 0 {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if session == nil || session.Step != StepPlanApproved {
+		return nil, nil, nil, &toolFailure{Reason: fmt.Sprintf("the session moved on while work item %q ran; its results were not recorded", itemID)}
+	}
+	item, _, ok := workItem(session, itemID)
+	if !ok || item.Status != itemInProgress {
+		return nil, nil, nil, &toolFailure{Reason: fmt.Sprintf("work item %q changed while its commands ran; their results were not recorded", itemID)}
+	}
+	return session, item, results, nil
+}
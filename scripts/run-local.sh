@@ -4,7 +4,8 @@ set -euo pipefail
 ROOT_DIR="$(cd "$(dirname "$0")/.." && pwd)"
 GO_BIN="$("$ROOT_DIR/scripts/bootstrap-go.sh")"
 OUT_BIN="$ROOT_DIR/.codex-mcp/bin/codex-mcp"
+VERSION="${VERSION:-$(git -C "$ROOT_DIR" describe --tags --always --dirty 2>/dev/null || echo dev)}"
 
-"$GO_BIN" build -o "$OUT_BIN" "$ROOT_DIR/cmd/codex-mcp"
+"$GO_BIN" build -ldflags "-X main.version=$VERSION" -o "$OUT_BIN" "$ROOT_DIR/cmd/codex-mcp"
 echo "CODEx MCP server: $OUT_BIN"
 "$OUT_BIN"
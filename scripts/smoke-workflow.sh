@@ -51,6 +51,11 @@ rpc_call() {
     echo "smoke failed: rpc error detected for method $method" >&2
     exit 1
   fi
+  if echo "$resp" | jq -e '.result.isError == true' >/dev/null; then
+    echo "$OUTPUT_LOG"
+    echo "smoke failed: tool error detected for method $method" >&2
+    exit 1
+  fi
 
   LAST_STRUCTURED="$(echo "$resp" | jq -c '.result.structuredContent // {}')"
 }
@@ -142,7 +147,7 @@ tool_call "clarify_intent" "$(jq -cn --arg sid "$SESSION_ID" --argjson tags "$TA
 tool_call "clarify_intent" "$(jq -cn --arg sid "$SESSION_ID" '{session_id:$sid,answers:{proposal_feedback:"go as-is"}}')"
 tool_call "generate_plan" "$(jq -cn --arg sid "$SESSION_ID" '{session_id:$sid}')"
 tool_call "generate_mockup" "$(jq -cn --arg sid "$SESSION_ID" '{session_id:$sid}')"
-tool_call "approve_plan" "$(jq -cn --arg sid "$SESSION_ID" --argjson tags "$TAGS_JSON" --arg criteria "$SMOKE_CRITERIA" '{session_id:$sid,approved:true,requirement_tags:$tags,success_criteria:[$criteria]}')"
+tool_call "approve_plan" "$(jq -cn --arg sid "$SESSION_ID" --argjson tags "$TAGS_JSON" --arg criteria "$SMOKE_CRITERIA" '{session_id:$sid,approved:true,requirement_tags:$tags,success_criteria:[$criteria],criteria_checks:[{criterion:$criteria,command:"echo ok"}]}')"
 tool_call "run_action" "$(jq -cn --arg sid "$SESSION_ID" '{session_id:$sid,commands:["echo smoke"],executor_role:"implementation_worker",executor_model:"gpt-5.3-codex-spark",delegated_by:"backend_lead",dry_run:true}')"
 tool_call "verify_result" "$(jq -cn --arg sid "$SESSION_ID" --argjson mcps "$AVAILABLE_MCPS_JSON" --argjson tools "$AVAILABLE_MCP_TOOLS_JSON" '{session_id:$sid,commands:["echo ok"],available_mcps:$mcps,available_mcp_tools:$tools}')"
 VERIFY_NEXT="$(echo "$LAST_STRUCTURED" | jq -r '.next_step // ""')"
@@ -0,0 +1,10 @@
+// Package skills embeds the Codex skill scripts so the MCP server can serve
+// them as prompts that always match the running binary.
+package skills
+
+import "embed"
+
+// FS holds every skills/<name>/SKILL.md file.
+//
+//go:embed */SKILL.md
+var FS embed.FS